@@ -2,15 +2,25 @@ package main
 
 import (
 	"context"
+	"face-track/internal/pkg/clients/face_cloud_fake"
 	"face-track/internal/pkg/handler"
 	"face-track/internal/pkg/service"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 )
 
+// fakeCloudCommand runs the fake Face Cloud instead of the app: "face-track fake-cloud".
+const fakeCloudCommand = "fake-cloud"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == fakeCloudCommand {
+		runUntilSignal(face_cloud_fake.NewServer())
+		return
+	}
+
 	s := service.NewServiceWithRepo()
 
 	runServer(s)
@@ -21,16 +31,37 @@ func runServer(s *service.Service) {
 	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	server := handler.NewServer(s)
+	s.StartWorkers(signalCtx)
+	s.StartDelivery(signalCtx)
+
+	serve(signalCtx, handler.NewServer(s))
+
+	log.Println("Waiting for running jobs")
+	s.WaitWorkers()
+	s.WaitDelivery()
+}
+
+// runUntilSignal serves until SIGINT or SIGTERM is received.
+func runUntilSignal(server *http.Server) {
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serve(signalCtx, server)
+}
+
+// serve runs the server until the context is done.
+func serve(ctx context.Context, server *http.Server) {
+
 	defer server.Close()
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("gin error: %s\n", err)
+			log.Fatalf("server error: %s\n", err)
 		}
 	}()
 
-	<-signalCtx.Done()
+	<-ctx.Done()
 
 	log.Println("Server exiting")
 }
@@ -0,0 +1,357 @@
+// Package archive extracts images from uploaded ZIP and TAR (optionally gzipped) archives.
+// Entries are streamed one at a time and guarded against zip bombs and unsafe paths;
+// skipped entries are reported with a reason.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"face-track/internal/pkg/model/task_model"
+	"face-track/tools"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Limits bound the resources an archive may take up.
+type Limits struct {
+	// MaxArchiveBytes is the largest archive accepted; ZIP archives are spooled to a temporary file.
+	MaxArchiveBytes int64
+
+	// MaxEntries is the largest number of entries read from the archive.
+	MaxEntries int
+
+	// MaxEntryBytes is the largest uncompressed size of an entry.
+	MaxEntryBytes int64
+
+	// MaxTotalBytes is the largest uncompressed size of all entries.
+	MaxTotalBytes int64
+
+	// MaxCompressionRatio is the largest ratio of uncompressed to compressed size of a ZIP entry.
+	MaxCompressionRatio int64
+}
+
+// DefaultLimits returns the limits suitable for photo sets.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxArchiveBytes:     1 << 30,
+		MaxEntries:          10000,
+		MaxEntryBytes:       50 << 20,
+		MaxTotalBytes:       4 << 30,
+		MaxCompressionRatio: 100,
+	}
+}
+
+// imageContentTypes maps extensions of supported images to their content types.
+var imageContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".webp": "image/webp",
+}
+
+// ErrEntryTooLarge is returned reading an entry larger than the limit.
+var ErrEntryTooLarge = errors.New("archive entry exceeds size limit")
+
+// Extractor iterates over the images of an archive.
+type Extractor struct {
+	limits Limits
+
+	next    func() (*entry, error)
+	closer  func() error
+	current io.Closer
+	skipped []*task_model.UploadResult
+
+	entries int
+	total   int64
+}
+
+// entry is a regular file of the archive.
+type entry struct {
+	name string
+	size int64
+	open func() (io.Reader, error)
+
+	// compressed is the compressed size of ZIP entries, zero otherwise
+	compressed int64
+}
+
+// NewExtractor detects the archive format by its content and returns an Extractor of the archive.
+// The Extractor must be closed.
+func NewExtractor(archive io.Reader, limits Limits) (e *Extractor, err error) {
+	e = &Extractor{limits: limits}
+
+	br := bufio.NewReader(archive)
+	header, _ := br.Peek(512)
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		err = e.openZip(br)
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(br); err == nil {
+			e.openTar(gz)
+			e.closer = gz.Close
+		}
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		e.openTar(br)
+	default:
+		err = errors.New("unsupported archive format: zip, tar and tar.gz are supported")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", tools.ErrInvalidInput, err)
+	}
+
+	return e, nil
+}
+
+// Close releases the resources of the archive.
+func (e *Extractor) Close() error {
+	e.closeCurrent()
+
+	if e.closer == nil {
+		return nil
+	}
+
+	return e.closer()
+}
+
+// Skipped returns the entries skipped so far with the reasons.
+func (e *Extractor) Skipped() []*task_model.UploadResult {
+	return e.skipped
+}
+
+// Next returns the next supported image of the archive; returns io.EOF after the last one.
+// The image must be read before the next call.
+func (e *Extractor) Next() (*task_model.FileData, error) {
+	e.closeCurrent()
+
+	for {
+		if e.entries >= e.limits.MaxEntries {
+			e.skip("", fmt.Sprintf("remaining entries skipped: archive has more than %d entries", e.limits.MaxEntries))
+			return nil, io.EOF
+		}
+
+		ent, err := e.next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: malformed archive: %w", tools.ErrInvalidInput, err)
+			}
+			return nil, io.EOF
+		}
+		if ent == nil {
+			// not a regular file
+			continue
+		}
+		e.entries++
+
+		// sizes of skipped entries count too: they are decompressed to be skipped
+		e.total += ent.size
+		if e.total > e.limits.MaxTotalBytes {
+			e.skip(ent.name, "remaining entries skipped: archive exceeds uncompressed size limit")
+			return nil, io.EOF
+		}
+
+		name, ok := safeName(ent.name)
+		if !ok {
+			e.skip(ent.name, "unsafe entry path")
+			continue
+		}
+
+		contentType, ok := imageContentTypes[strings.ToLower(path.Ext(name))]
+		if !ok || strings.HasPrefix(name, ".") {
+			e.skip(ent.name, "not a supported image")
+			continue
+		}
+
+		if ent.size > e.limits.MaxEntryBytes {
+			e.skip(ent.name, ErrEntryTooLarge.Error())
+			continue
+		}
+
+		if ent.compressed > 0 && ent.size/ent.compressed > e.limits.MaxCompressionRatio {
+			e.skip(ent.name, "suspicious compression ratio")
+			continue
+		}
+
+		r, err := ent.open()
+		if err != nil {
+			e.skip(ent.name, fmt.Sprintf("failed to read entry: %v", err))
+			continue
+		}
+		if closer, ok := r.(io.Closer); ok {
+			e.current = closer
+		}
+
+		return &task_model.FileData{
+			// declared sizes may lie, the limit is enforced on the read data
+			File:        &limitedReader{r: r, n: e.limits.MaxEntryBytes},
+			FileName:    name,
+			ContentType: contentType,
+		}, nil
+	}
+}
+
+// closeCurrent closes the entry returned last.
+func (e *Extractor) closeCurrent() {
+	if e.current != nil {
+		_ = e.current.Close()
+		e.current = nil
+	}
+}
+
+// skip records the skipped entry.
+func (e *Extractor) skip(name, reason string) {
+	e.skipped = append(e.skipped, &task_model.UploadResult{
+		FileName: name,
+		Status:   "skipped",
+		Reason:   reason,
+	})
+}
+
+// openTar reads the TAR archive as a stream.
+func (e *Extractor) openTar(r io.Reader) {
+	tr := tar.NewReader(r)
+
+	e.next = func() (*entry, error) {
+		header, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			if header.Typeflag != tar.TypeDir {
+				e.entries++
+				e.skip(header.Name, "not a regular file")
+			}
+			return nil, nil
+		}
+
+		return &entry{
+			name: header.Name,
+			size: header.Size,
+			open: func() (io.Reader, error) { return tr, nil },
+		}, nil
+	}
+}
+
+// openZip spools the ZIP archive to a temporary file, as entries are listed at its end.
+func (e *Extractor) openZip(r io.Reader) (err error) {
+
+	file, err := os.CreateTemp("", "face-track-archive-*.zip")
+	if err != nil {
+		return err
+	}
+	e.closer = func() error {
+		file.Close()
+		return os.Remove(file.Name())
+	}
+	defer func() {
+		if err != nil {
+			_ = e.Close()
+		}
+	}()
+
+	size, err := io.Copy(file, io.LimitReader(r, e.limits.MaxArchiveBytes+1))
+	if err != nil {
+		return err
+	}
+	if size > e.limits.MaxArchiveBytes {
+		return fmt.Errorf("archive exceeds %d bytes", e.limits.MaxArchiveBytes)
+	}
+
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+
+	files := zr.File
+
+	e.next = func() (*entry, error) {
+		if len(files) == 0 {
+			return nil, io.EOF
+		}
+		f := files[0]
+		files = files[1:]
+
+		if f.FileInfo().IsDir() {
+			return nil, nil
+		}
+		if !f.Mode().IsRegular() {
+			e.entries++
+			e.skip(f.Name, "not a regular file")
+			return nil, nil
+		}
+
+		return &entry{
+			name:       f.Name,
+			size:       int64(f.UncompressedSize64),
+			compressed: max(int64(f.CompressedSize64), 1),
+			open: func() (io.Reader, error) {
+				return f.Open()
+			},
+		}, nil
+	}
+
+	return nil
+}
+
+// safeName returns the file name of the entry, or false if the entry path is absolute
+// or leads out of the archive.
+func safeName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+
+	if path.IsAbs(name) || strings.Contains(name, ":") {
+		return "", false
+	}
+
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+
+	base := path.Base(clean)
+	if base == "." || base == "/" {
+		return "", false
+	}
+
+	return base, true
+}
+
+// limitedReader reads up to n bytes and fails with ErrEntryTooLarge if there is more data.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// check whether the data ends exactly at the limit
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n > 0 {
+			return 0, ErrEntryTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+
+	return n, err
+}
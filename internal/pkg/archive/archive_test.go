@@ -0,0 +1,274 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"face-track/internal/pkg/archive"
+	"face-track/tools"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEntry is a file put into test archives.
+type testEntry struct {
+	name string
+	data string
+}
+
+func zipArchive(t *testing.T, entries []testEntry) []byte {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, entries []testEntry) []byte {
+	var buf bytes.Buffer
+
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Mode:     0644,
+			Size:     int64(len(entry.data)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// extract reads all images of the archive; returns names and contents of images and names of skipped entries.
+func extract(data []byte, limits archive.Limits) (images map[string]string, skipped []string, err error) {
+
+	extractor, err := archive.NewExtractor(bytes.NewReader(data), limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer extractor.Close()
+
+	images = make(map[string]string)
+	for {
+		file, err := extractor.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		content, err := io.ReadAll(file.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		images[file.FileName] = string(content)
+	}
+
+	for _, result := range extractor.Skipped() {
+		skipped = append(skipped, result.FileName)
+	}
+
+	return images, skipped, nil
+}
+
+func Test_Extractor_Next(t *testing.T) {
+
+	entries := []testEntry{
+		{name: "photos/a.jpg", data: "image a"},
+		{name: "B.JPEG", data: "image b"},
+		{name: "notes.txt", data: "text"},
+		{name: "../escape.jpg", data: "image c"},
+		{name: "/etc/abs.jpg", data: "image d"},
+		{name: "photos/../../up.jpg", data: "image e"},
+		{name: "big.jpg", data: strings.Repeat("x", 100)},
+	}
+
+	limits := archive.DefaultLimits()
+	limits.MaxEntryBytes = 50
+
+	wantImages := map[string]string{
+		"a.jpg":  "image a",
+		"B.JPEG": "image b",
+	}
+	wantSkipped := []string{"notes.txt", "../escape.jpg", "/etc/abs.jpg", "photos/../../up.jpg", "big.jpg"}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "zip",
+			data: zipArchive(t, entries),
+		},
+		{
+			name: "tar.gz",
+			data: tarGzArchive(t, entries),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			images, skipped, err := extract(tt.data, limits)
+			if err != nil {
+				t.Fatalf("extractor.Next() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(images, wantImages) {
+				t.Errorf("extractor.Next() images = %v, want %v", images, wantImages)
+			}
+
+			if !reflect.DeepEqual(skipped, wantSkipped) {
+				t.Errorf("extractor.Skipped() = %v, want %v", skipped, wantSkipped)
+			}
+		})
+	}
+}
+
+func Test_Extractor_Limits(t *testing.T) {
+
+	entries := []testEntry{
+		{name: "a.jpg", data: "image a"},
+		{name: "b.jpg", data: "image b"},
+		{name: "c.jpg", data: "image c"},
+	}
+
+	tests := []struct {
+		name       string
+		limits     func(limits *archive.Limits)
+		wantImages int
+	}{
+		{
+			name:       "max entries",
+			limits:     func(limits *archive.Limits) { limits.MaxEntries = 2 },
+			wantImages: 2,
+		},
+		{
+			name:       "max total bytes",
+			limits:     func(limits *archive.Limits) { limits.MaxTotalBytes = 10 },
+			wantImages: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			limits := archive.DefaultLimits()
+			tt.limits(&limits)
+
+			images, skipped, err := extract(tarGzArchive(t, entries), limits)
+			if err != nil {
+				t.Fatalf("extractor.Next() error = %v", err)
+			}
+
+			if len(images) != tt.wantImages {
+				t.Errorf("extractor.Next() returned %d images, want %d", len(images), tt.wantImages)
+			}
+
+			if len(skipped) != 1 {
+				t.Errorf("extractor.Skipped() = %v, want the limit reported once", skipped)
+			}
+		})
+	}
+}
+
+func Test_NewExtractor(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    []byte
+		limits  func(limits *archive.Limits)
+		wantErr bool
+	}{
+		{
+			name:    "not an archive",
+			data:    []byte("plain text"),
+			wantErr: true,
+		},
+		{
+			name:    "zip exceeds max archive bytes",
+			data:    zipArchive(t, []testEntry{{name: "a.jpg", data: strings.Repeat("x", 1000)}}),
+			limits:  func(limits *archive.Limits) { limits.MaxArchiveBytes = 100 },
+			wantErr: true,
+		},
+		{
+			name: "empty zip",
+			data: zipArchive(t, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			limits := archive.DefaultLimits()
+			if tt.limits != nil {
+				tt.limits(&limits)
+			}
+
+			extractor, err := archive.NewExtractor(bytes.NewReader(tt.data), limits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("archive.NewExtractor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, tools.ErrInvalidInput) {
+					t.Errorf("archive.NewExtractor() error = %v, want invalid input", err)
+				}
+				return
+			}
+			_ = extractor.Close()
+		})
+	}
+}
+
+func Test_Extractor_EntryAtLimit(t *testing.T) {
+
+	// an entry of exactly the limit size is read completely
+	limits := archive.DefaultLimits()
+	limits.MaxEntryBytes = 5
+
+	extractor, err := archive.NewExtractor(bytes.NewReader(tarGzArchive(t, []testEntry{{name: "a.jpg", data: "12345"}})), limits)
+	if err != nil {
+		t.Fatalf("archive.NewExtractor() error = %v", err)
+	}
+	defer extractor.Close()
+
+	file, err := extractor.Next()
+	if err != nil {
+		t.Fatalf("extractor.Next() error = %v", err)
+	}
+
+	if content, err := io.ReadAll(file.File); err != nil || string(content) != "12345" {
+		t.Errorf("reading entry at the limit = %q, %v, want %q", content, err, "12345")
+	}
+}
@@ -0,0 +1,105 @@
+// Package blob_store provides a pluggable storage backend for task image files.
+// The backend is selected by configuration, so the rest of the app does not depend on where files are kept.
+package blob_store
+
+import (
+	"context"
+	"face-track/internal/pkg/blob_store/local_store"
+	"face-track/internal/pkg/blob_store/s3_store"
+	"face-track/tools"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// blobStoreEnvName is the env variable key for the storage backend name.
+	blobStoreEnvName = "FACE_TRACK__BLOB_STORE"
+
+	// localDirEnvName is the env variable key for the directory of the local storage.
+	localDirEnvName = "FACE_TRACK__BLOB_DIR"
+
+	// s3EndpointEnvName is the env variable key for the S3-compatible storage URL.
+	s3EndpointEnvName = "FACE_TRACK__S3_ENDPOINT"
+
+	// s3RegionEnvName is the env variable key for the S3 region.
+	s3RegionEnvName = "FACE_TRACK__S3_REGION"
+
+	// s3BucketEnvName is the env variable key for the S3 bucket keeping the files.
+	s3BucketEnvName = "FACE_TRACK__S3_BUCKET"
+
+	// s3AccessKeyEnvName is the env variable key for the S3 access key ID.
+	s3AccessKeyEnvName = "FACE_TRACK__S3_ACCESS_KEY"
+
+	// s3SecretKeyEnvName is the env variable key for the S3 secret access key.
+	s3SecretKeyEnvName = "FACE_TRACK__S3_SECRET_KEY"
+
+	// s3TimeoutEnvName is the env variable key for the timeout of a single S3 request.
+	s3TimeoutEnvName = "FACE_TRACK__S3_TIMEOUT"
+
+	// Local is the name of the local filesystem backend.
+	Local = local_store.Name
+
+	// S3 is the name of the S3-compatible backend.
+	S3 = s3_store.Name
+)
+
+// BlobStore defines the interface for storage backends. Keys are slash separated paths;
+// files of a task share the key prefix.
+type BlobStore interface {
+	// Put stores the blob, replacing the existing one.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get opens the blob; returns tools.ErrNotFound if there is no such blob. The blob must be closed.
+	Get(ctx context.Context, key string) (blob io.ReadCloser, size int64, err error)
+	// Delete removes the blob; deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns keys of the blobs starting with the prefix.
+	List(ctx context.Context, prefix string) (keys []string, err error)
+}
+
+// NewBlobStore creates the storage backend selected by the FACE_TRACK__BLOB_STORE env variable.
+// Files are kept in ~/face-track/images when the variable is not set.
+func NewBlobStore() (store BlobStore, err error) {
+
+	name := os.Getenv(blobStoreEnvName)
+	if name == "" {
+		name = Local
+	}
+
+	switch name {
+	case Local:
+		dir := os.Getenv(localDirEnvName)
+		if dir == "" {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			dir = filepath.Join(homeDir, "face-track", "images")
+		}
+		return local_store.New(dir), nil
+	case S3:
+		tools.CheckEnvs(s3EndpointEnvName, s3BucketEnvName, s3AccessKeyEnvName, s3SecretKeyEnvName)
+
+		region := os.Getenv(s3RegionEnvName)
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		s3Store, err := s3_store.New(s3_store.Config{
+			Endpoint:  os.Getenv(s3EndpointEnvName),
+			Region:    region,
+			Bucket:    os.Getenv(s3BucketEnvName),
+			AccessKey: os.Getenv(s3AccessKeyEnvName),
+			SecretKey: os.Getenv(s3SecretKeyEnvName),
+			Timeout:   tools.GetEnvDuration(s3TimeoutEnvName, 30*time.Second),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s3Store, nil
+	default:
+		return nil, fmt.Errorf("unknown blob store: %s", name)
+	}
+}
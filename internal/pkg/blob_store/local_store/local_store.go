@@ -0,0 +1,163 @@
+// Package local_store implements blob storage in a local filesystem directory.
+package local_store
+
+import (
+	"context"
+	"errors"
+	"face-track/tools"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Name is the backend name of the store.
+const Name = "local"
+
+// LocalStore keeps blobs as files under the root directory; keys are slash separated relative paths.
+type LocalStore struct {
+	root string
+}
+
+// New creates a new LocalStore keeping blobs under the root directory.
+func New(root string) *LocalStore {
+	return &LocalStore{
+		root: filepath.Clean(root),
+	}
+}
+
+// Put writes the blob; the file is replaced atomically, so readers never see a partial blob.
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte) (err error) {
+
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// Get opens the blob; returns tools.ErrNotFound if there is no such blob.
+func (s *LocalStore) Get(ctx context.Context, key string) (blob io.ReadCloser, size int64, err error) {
+
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, tools.ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+
+	return file, info.Size(), nil
+}
+
+// Delete removes the blob and the directories left empty; deleting a missing blob is not an error.
+func (s *LocalStore) Delete(ctx context.Context, key string) (err error) {
+
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// fails on directories which are not empty
+	for dir := filepath.Dir(filePath); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// List returns keys of the blobs starting with the prefix.
+func (s *LocalStore) List(ctx context.Context, prefix string) (keys []string, err error) {
+
+	// walk the deepest directory of the prefix
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		if dir, err = s.path(prefix[:i]); err != nil {
+			return nil, err
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// path returns the file path of the key; returns error if the key leads out of the root.
+func (s *LocalStore) path(key string) (string, error) {
+
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", fmt.Errorf("invalid blob key: %q", key)
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,76 @@
+package local_store_test
+
+import (
+	"context"
+	"errors"
+	"face-track/internal/pkg/blob_store/local_store"
+	"face-track/tools"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_LocalStore(t *testing.T) {
+
+	ctx := context.Background()
+	root := t.TempDir()
+	store := local_store.New(root)
+
+	for _, key := range []string{"1/1/a.jpg", "1/1/b.png", "1/10/c.jpg", "2/2/d.jpg"} {
+		if err := store.Put(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("localStore.Put() error = %v", err)
+		}
+	}
+
+	blob, size, err := store.Get(ctx, "1/1/b.png")
+	if err != nil {
+		t.Fatalf("localStore.Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(blob)
+	_ = blob.Close()
+	if string(data) != "1/1/b.png" || size != int64(len(data)) {
+		t.Errorf("localStore.Get() = %q, %d, want the stored blob", data, size)
+	}
+
+	keys, err := store.List(ctx, "1/1/")
+	sort.Strings(keys)
+	if err != nil || !reflect.DeepEqual(keys, []string{"1/1/a.jpg", "1/1/b.png"}) {
+		t.Errorf("localStore.List() = %v, %v, want the blobs of the prefix", keys, err)
+	}
+
+	for _, key := range keys {
+		if err = store.Delete(ctx, key); err != nil {
+			t.Fatalf("localStore.Delete() error = %v", err)
+		}
+	}
+
+	if _, _, err = store.Get(ctx, "1/1/a.jpg"); !errors.Is(err, tools.ErrNotFound) {
+		t.Errorf("localStore.Get() of deleted blob error = %v, want %v", err, tools.ErrNotFound)
+	}
+
+	if err = store.Delete(ctx, "1/1/a.jpg"); err != nil {
+		t.Errorf("localStore.Delete() of missing blob error = %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(root, "1", "1")); !os.IsNotExist(err) {
+		t.Errorf("localStore.Delete() left the empty directory")
+	}
+
+	if keys, err = store.List(ctx, "3/3/"); err != nil || len(keys) != 0 {
+		t.Errorf("localStore.List() of missing prefix = %v, %v, want none", keys, err)
+	}
+}
+
+func Test_LocalStore_InvalidKey(t *testing.T) {
+
+	store := local_store.New(t.TempDir())
+
+	for _, key := range []string{"", "../a.jpg", "1/../../a.jpg", "/a.jpg"} {
+		if err := store.Put(context.Background(), key, []byte("a")); err == nil {
+			t.Errorf("localStore.Put(%q) did not fail", key)
+		}
+	}
+}
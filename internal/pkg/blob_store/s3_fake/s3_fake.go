@@ -0,0 +1,210 @@
+// Package s3_fake provides an in-process fake of an S3-compatible object storage for tests.
+// It serves path-style PutObject, GetObject, DeleteObject and ListObjectsV2 requests of a single bucket,
+// keeps objects in memory and rejects requests which are not signed with the configured credentials.
+package s3_fake
+
+import (
+	"bytes"
+	"encoding/xml"
+	"face-track/internal/pkg/blob_store/sigv4"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Config holds the behaviour of the fake storage.
+type Config struct {
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// MaxKeys is the size of a listing page unless the request asks for fewer keys.
+	MaxKeys int
+}
+
+// FakeS3 is an http.Handler faking an S3-compatible storage. It is safe for concurrent use.
+type FakeS3 struct {
+	cfg Config
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// New creates a new FakeS3 with the given configuration.
+func New(cfg Config) *FakeS3 {
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = 1000
+	}
+
+	return &FakeS3{
+		cfg:     cfg,
+		objects: make(map[string][]byte),
+	}
+}
+
+// NewTestServer starts an httptest server running a FakeS3; the caller must close the server.
+func NewTestServer(cfg Config) (fake *FakeS3, server *httptest.Server) {
+	fake = New(cfg)
+	return fake, httptest.NewServer(fake)
+}
+
+// Object returns the stored object.
+func (f *FakeS3) Object(key string) (data []byte, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok = f.objects[key]
+	return data, ok
+}
+
+// ServeHTTP implements http.Handler.
+func (f *FakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	creds := sigv4.Credentials{
+		AccessKey: f.cfg.AccessKey,
+		SecretKey: f.cfg.SecretKey,
+		Region:    f.cfg.Region,
+		Service:   "s3",
+	}
+	if !sigv4.Verify(r, creds) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.cfg.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case key != "" && r.Method == http.MethodPut:
+		f.put(w, r, key)
+	case key != "" && r.Method == http.MethodGet:
+		f.get(w, key)
+	case key != "" && r.Method == http.MethodDelete:
+		f.delete(w, key)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// put stores the object; the body must match the signed payload hash.
+func (f *FakeS3) put(w http.ResponseWriter, r *http.Request, key string) {
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	if sigv4.PayloadHash(data) != r.Header.Get("X-Amz-Content-Sha256") {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+
+	f.mu.Lock()
+	f.objects[key] = data
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// get returns the object.
+func (f *FakeS3) get(w http.ResponseWriter, key string) {
+
+	data, ok := f.Object(key)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = io.Copy(w, bytes.NewReader(data))
+}
+
+// delete removes the object.
+func (f *FakeS3) delete(w http.ResponseWriter, key string) {
+
+	f.mu.Lock()
+	delete(f.objects, key)
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list returns a page of keys with the prefix in lexicographical order; the continuation token
+// is the last returned key.
+func (f *FakeS3) list(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	maxKeys := f.cfg.MaxKeys
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n > 0 && n < maxKeys {
+		maxKeys = n
+	}
+
+	f.mu.Lock()
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	f.mu.Unlock()
+
+	sort.Strings(keys)
+
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string   `xml:"Name"`
+		Prefix                string   `xml:"Prefix"`
+		KeyCount              int      `xml:"KeyCount"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+		Contents              []object `xml:"Contents"`
+	}{
+		Name:   f.cfg.Bucket,
+		Prefix: prefix,
+	}
+
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+
+	result.KeyCount = len(keys)
+	for _, key := range keys {
+		result.Contents = append(result.Contents, object{Key: key})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// writeError writes the S3 error response.
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+	}{Code: code})
+}
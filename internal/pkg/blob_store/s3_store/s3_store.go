@@ -0,0 +1,221 @@
+// Package s3_store implements blob storage in a bucket of an S3-compatible object storage
+// (AWS S3, MinIO, Ceph and others). Requests are signed with AWS Signature Version 4
+// and use path-style addressing.
+package s3_store
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"face-track/internal/pkg/blob_store/sigv4"
+	"face-track/tools"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Name is the backend name of the store.
+const Name = "s3"
+
+// Config holds the connection settings of the storage.
+type Config struct {
+	// Endpoint is the storage URL, e.g. "https://s3.eu-central-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Timeout bounds a single request.
+	Timeout time.Duration
+}
+
+// S3Store keeps blobs as objects of the bucket; keys are object keys.
+type S3Store struct {
+	endpoint *url.URL
+	bucket   string
+	creds    sigv4.Credentials
+	client   *http.Client
+}
+
+// listResult is the response of the ListObjectsV2 request.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// New creates a new S3Store of the bucket.
+func New(cfg Config) (store *S3Store, err error) {
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %q", cfg.Endpoint)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is not set")
+	}
+
+	return &S3Store{
+		endpoint: endpoint,
+		bucket:   cfg.Bucket,
+		creds: sigv4.Credentials{
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			Region:    cfg.Region,
+			Service:   "s3",
+		},
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Put uploads the object.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) (err error) {
+
+	resp, err := s.do(ctx, http.MethodPut, s.objectUrl(key), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// Get downloads the object; returns tools.ErrNotFound if there is no such object.
+func (s *S3Store) Get(ctx context.Context, key string) (blob io.ReadCloser, size int64, err error) {
+
+	resp, err := s.do(ctx, http.MethodGet, s.objectUrl(key), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, tools.ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, 0, responseError(resp)
+	}
+}
+
+// Delete removes the object; deleting a missing object is not an error.
+func (s *S3Store) Delete(ctx context.Context, key string) (err error) {
+
+	resp, err := s.do(ctx, http.MethodDelete, s.objectUrl(key), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// List returns keys of the objects starting with the prefix; all pages of the listing are read.
+func (s *S3Store) List(ctx context.Context, prefix string) (keys []string, err error) {
+	var token string
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		listUrl := s.bucketUrl()
+		listUrl.RawQuery = query.Encode()
+
+		result, err := s.list(ctx, listUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// list requests a page of the listing.
+func (s *S3Store) list(ctx context.Context, listUrl *url.URL) (result *listResult, err error) {
+
+	resp, err := s.do(ctx, http.MethodGet, listUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	result = &listResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// do sends the signed request.
+func (s *S3Store) do(ctx context.Context, method string, requestUrl *url.URL, body []byte) (resp *http.Response, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	sigv4.Sign(req, sigv4.PayloadHash(body), s.creds, time.Now())
+
+	return s.client.Do(req)
+}
+
+// bucketUrl returns the URL of the bucket.
+func (s *S3Store) bucketUrl() *url.URL {
+	bucketUrl := *s.endpoint
+	bucketUrl.Path = s.endpoint.Path + "/" + s.bucket
+	return &bucketUrl
+}
+
+// objectUrl returns the URL of the object.
+func (s *S3Store) objectUrl(key string) *url.URL {
+	objectUrl := s.bucketUrl()
+	objectUrl.Path += "/" + key
+	return objectUrl
+}
+
+// responseError returns the error of the failed request with the S3 error code, if any.
+func responseError(resp *http.Response) error {
+	var s3Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(body, &s3Error) == nil && s3Error.Code != "" {
+		return fmt.Errorf("s3 request failed: %s: %s: %s", resp.Status, s3Error.Code, s3Error.Message)
+	}
+
+	return fmt.Errorf("s3 request failed: %s", resp.Status)
+}
@@ -0,0 +1,97 @@
+package s3_store_test
+
+import (
+	"context"
+	"errors"
+	"face-track/internal/pkg/blob_store/s3_fake"
+	"face-track/internal/pkg/blob_store/s3_store"
+	"face-track/tools"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var fakeConfig = s3_fake.Config{
+	Bucket:    "images",
+	Region:    "eu-central-1",
+	AccessKey: "access",
+	SecretKey: "secret",
+	MaxKeys:   2,
+}
+
+func newStore(t *testing.T, endpoint string, secretKey string) *s3_store.S3Store {
+	store, err := s3_store.New(s3_store.Config{
+		Endpoint:  endpoint,
+		Region:    fakeConfig.Region,
+		Bucket:    fakeConfig.Bucket,
+		AccessKey: fakeConfig.AccessKey,
+		SecretKey: secretKey,
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func Test_S3Store(t *testing.T) {
+
+	ctx := context.Background()
+
+	fake, server := s3_fake.NewTestServer(fakeConfig)
+	defer server.Close()
+
+	store := newStore(t, server.URL, fakeConfig.SecretKey)
+
+	keys := []string{"1/1/a b.jpg", "1/1/b.png", "1/1/c.jpg", "1/10/d.jpg"}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("s3Store.Put() error = %v", err)
+		}
+	}
+
+	if data, ok := fake.Object("1/1/a b.jpg"); !ok || string(data) != "1/1/a b.jpg" {
+		t.Errorf("s3Store.Put() stored %q, want the blob", data)
+	}
+
+	blob, size, err := store.Get(ctx, "1/1/b.png")
+	if err != nil {
+		t.Fatalf("s3Store.Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(blob)
+	_ = blob.Close()
+	if string(data) != "1/1/b.png" || size != int64(len(data)) {
+		t.Errorf("s3Store.Get() = %q, %d, want the stored blob", data, size)
+	}
+
+	// the listing has more pages than one
+	listed, err := store.List(ctx, "1/1/")
+	if err != nil || !reflect.DeepEqual(listed, keys[:3]) {
+		t.Errorf("s3Store.List() = %v, %v, want %v", listed, err, keys[:3])
+	}
+
+	if err = store.Delete(ctx, "1/1/b.png"); err != nil {
+		t.Fatalf("s3Store.Delete() error = %v", err)
+	}
+
+	if _, _, err = store.Get(ctx, "1/1/b.png"); !errors.Is(err, tools.ErrNotFound) {
+		t.Errorf("s3Store.Get() of deleted blob error = %v, want %v", err, tools.ErrNotFound)
+	}
+
+	if err = store.Delete(ctx, "1/1/b.png"); err != nil {
+		t.Errorf("s3Store.Delete() of missing blob error = %v", err)
+	}
+}
+
+func Test_S3Store_WrongCredentials(t *testing.T) {
+
+	_, server := s3_fake.NewTestServer(fakeConfig)
+	defer server.Close()
+
+	store := newStore(t, server.URL, "wrong")
+
+	if err := store.Put(context.Background(), "1/1/a.jpg", []byte("a")); err == nil {
+		t.Errorf("s3Store.Put() with wrong credentials did not fail")
+	}
+}
@@ -0,0 +1,210 @@
+// Package sigv4 signs HTTP requests with AWS Signature Version 4 as expected by S3-compatible storages.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// algorithm is the signing algorithm name.
+	algorithm = "AWS4-HMAC-SHA256"
+
+	// timeFormat is the format of the X-Amz-Date header.
+	timeFormat = "20060102T150405Z"
+
+	// dateFormat is the format of the date in the credential scope.
+	dateFormat = "20060102"
+)
+
+// EmptyPayloadHash is the SHA-256 of an empty body.
+const EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Credentials identify the signer.
+type Credentials struct {
+	AccessKey string
+	SecretKey string
+	Region    string
+	Service   string
+}
+
+// PayloadHash returns the hex encoded SHA-256 of the request body.
+func PayloadHash(payload []byte) string {
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:])
+}
+
+// Sign sets the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers of the request.
+// The host and all headers set on the request are signed.
+func Sign(req *http.Request, payloadHash string, creds Credentials, now time.Time) {
+	now = now.UTC()
+
+	req.Header.Set("X-Amz-Date", now.Format(timeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Del("Authorization")
+
+	signedHeaders, signature := signature(req, payloadHash, creds, now)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKey, scope(creds, now), signedHeaders, signature))
+}
+
+// Verify reports whether the request is signed with the credentials; the access key and region are taken
+// from the credentials, the signed headers and the time from the request.
+func Verify(req *http.Request, creds Credentials) bool {
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, algorithm+" ") {
+		return false
+	}
+
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(auth, algorithm+" "), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[key] = value
+	}
+
+	now, err := time.Parse(timeFormat, req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	if fields["Credential"] != creds.AccessKey+"/"+scope(creds, now) {
+		return false
+	}
+
+	// only the headers listed by the client are signed
+	signed := req.Clone(req.Context())
+	signed.Header = make(http.Header)
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		if name != "host" {
+			signed.Header[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+		}
+	}
+
+	signedHeaders, signature := signature(signed, req.Header.Get("X-Amz-Content-Sha256"), creds, now)
+
+	return signedHeaders == fields["SignedHeaders"] && hmac.Equal([]byte(signature), []byte(fields["Signature"]))
+}
+
+// signature returns the list of signed headers and the signature of the request.
+func signature(req *http.Request, payloadHash string, creds Credentials, now time.Time) (signedHeaders string, signature string) {
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" {
+			continue
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		algorithm,
+		now.Format(timeFormat),
+		scope(creds, now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), now.Format(dateFormat))
+	key = hmacSHA256(key, creds.Region)
+	key = hmacSHA256(key, creds.Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// scope returns the credential scope of the date.
+func scope(creds Credentials, now time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", now.Format(dateFormat), creds.Region, creds.Service)
+}
+
+// canonicalPath returns the URI encoded path; S3 paths are encoded once.
+func canonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = Escape(unescaped)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery returns the query parameters sorted by name with names and values URI encoded.
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, Escape(name)+"="+Escape(value))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// Escape URI encodes the string: every byte except the unreserved characters is percent-encoded.
+func Escape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package face_cloud_client
+
+import (
+	"errors"
+	"face-track/tools"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error kinds returned by the Face Cloud client; check them with errors.Is.
+var (
+	// ErrUnauthorized is returned when Face Cloud rejects the credentials or the access token.
+	ErrUnauthorized = errors.New("face cloud: unauthorized")
+
+	// ErrRateLimited is returned when Face Cloud limits the request rate.
+	ErrRateLimited = errors.New("face cloud: rate limited")
+
+	// ErrBadImage is returned when Face Cloud is unable to process the sent image.
+	ErrBadImage = errors.New("face cloud: bad image")
+
+	// ErrBadRequest is returned for other requests rejected by Face Cloud.
+	ErrBadRequest = errors.New("face cloud: bad request")
+
+	// ErrServer is returned when Face Cloud fails to handle the request.
+	ErrServer = errors.New("face cloud: server error")
+
+	// ErrNetwork is returned when Face Cloud could not be reached.
+	ErrNetwork = errors.New("face cloud: network error")
+
+	// ErrProviderUnavailable is returned without sending the request while the circuit breaker is open.
+	ErrProviderUnavailable = fmt.Errorf("face cloud: %w", tools.ErrProviderUnavailable)
+)
+
+// RequestError describes a failed Face Cloud request.
+type RequestError struct {
+	// Kind is one of the error kinds declared above.
+	Kind error
+	// StatusCode is the HTTP status returned by Face Cloud; zero for network errors.
+	StatusCode int
+	// RetryAfter is the delay requested by Face Cloud via the Retry-After header.
+	RetryAfter time.Duration
+	// Err is the underlying error for network failures.
+	Err error
+}
+
+// Error returns the error description.
+func (e *RequestError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+	}
+	if e.StatusCode == 0 {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%v: server returned status: %d %s", e.Kind, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap returns the error kind and the underlying error.
+func (e *RequestError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *RequestError) Temporary() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrServer || e.Kind == ErrNetwork
+}
+
+// classifyStatus returns the error kind for an HTTP error status.
+func classifyStatus(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusBadRequest ||
+		statusCode == http.StatusRequestEntityTooLarge ||
+		statusCode == http.StatusUnsupportedMediaType ||
+		statusCode == http.StatusUnprocessableEntity:
+		return ErrBadImage
+	case statusCode >= 500:
+		return ErrServer
+	default:
+		return ErrBadRequest
+	}
+}
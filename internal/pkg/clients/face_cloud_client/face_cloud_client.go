@@ -3,49 +3,218 @@ package face_cloud_client
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"face-track/internal/pkg/model/face_cloud_model"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
-const (
-	faceCloudApiUrlEnvName   = "FACE_CLOUD__API_URL"
-	faceCloudUserEnvName     = "FACE_CLOUD__API_USER"
-	faceCloudPasswordEnvName = "FACE_CLOUD__API_PASS"
-)
+// Config holds the settings of a FaceCloudClient.
+type Config struct {
+	// BaseURL is the Face Cloud API URL, e.g. "https://backend.facecloud.tevian.ru/api/v1".
+	BaseURL string
+	// Email and Password are the Face Cloud account credentials.
+	Email    string
+	Password string
+
+	// Timeout limits a single HTTP request, including reading the response body.
+	Timeout time.Duration
+	// MaxIdleConns limits the number of idle keep-alive connections to Face Cloud.
+	MaxIdleConns int
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+	// ProxyURL is the proxy for Face Cloud requests; the standard proxy env variables are used if empty.
+	ProxyURL string
+	// TLSCAFile is a PEM file with additional root certificates.
+	TLSCAFile string
+	// TLSInsecureSkipVerify disables verification of the server certificate.
+	TLSInsecureSkipVerify bool
+
+	// Retry configures retries of temporary failures.
+	Retry RetryPolicy
+	// RateLimit is the maximum number of requests per second; zero disables the limit.
+	RateLimit float64
+	// RateBurst is the maximum burst of requests.
+	RateBurst int
+	// BreakerThreshold is the number of consecutive failed requests opening the circuit breaker, a request
+	// failing once its retries are exhausted; zero disables it.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit breaker stays open.
+	BreakerCooldown time.Duration
+}
+
+// DefaultConfig returns a Config with default connection settings and no URL or credentials.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:          10 * time.Second,
+		MaxIdleConns:     20,
+		IdleConnTimeout:  90 * time.Second,
+		Retry:            DefaultRetryPolicy(),
+		RateLimit:        10,
+		RateBurst:        10,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// FaceCloudClient is a Face Cloud API client. It is meant to be created once and shared:
+// the connection pool, the access token, the rate limiter and the circuit breaker are process-wide.
+type FaceCloudClient struct {
+	baseURL  string
+	email    string
+	password string
+
+	httpClient *http.Client
+	retry      RetryPolicy
+	limiter    *RateLimiter
+	breaker    *CircuitBreaker
+	tokens     *tokenManager
+}
+
+// New creates a new FaceCloudClient with the given configuration.
+func New(cfg Config) (client *FaceCloudClient, err error) {
+
+	if cfg.BaseURL == "" {
+		return nil, errors.New("face cloud: base url is not set")
+	}
+
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client = &FaceCloudClient{
+		baseURL:  strings.TrimRight(cfg.BaseURL, "/"),
+		email:    cfg.Email,
+		password: cfg.Password,
+		httpClient: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+		},
+		retry:   cfg.Retry,
+		limiter: NewRateLimiter(cfg.RateLimit, cfg.RateBurst),
+		breaker: NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+	client.tokens = newTokenManager(client.login)
+
+	return client, nil
+}
+
+// newTransport creates the pooled HTTP transport with proxy and TLS settings.
+func newTransport(cfg Config) (transport *http.Transport, err error) {
 
-// DetectFases sends a request to the Face Cloud API to detect faces in images.
-func DetectFaces(file *os.File, token string) (b []byte, err error) {
+	transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConns,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSHandshakeTimeout: cfg.Timeout,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		},
+	}
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("face cloud: invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("face cloud: failed to read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("face cloud: no certificates found in CA file")
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	return transport, nil
+}
+
+// DetectFaces sends the image to Face Cloud using the cached access token and returns the raw response.
+// If Face Cloud rejects the token, it logs in again once and repeats the request.
+func (c *FaceCloudClient) DetectFaces(ctx context.Context, image []byte) (b []byte, err error) {
+
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = c.detectFaces(ctx, image, token)
+	if !errors.Is(err, ErrUnauthorized) {
+		return b, err
+	}
 
-	url := fmt.Sprintf("%s/detect?demographics=true", os.Getenv(faceCloudApiUrlEnvName))
+	c.tokens.Invalidate(token)
 
-	req, err := http.NewRequest("POST", url, file)
+	token, err = c.tokens.Token(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	fileInfo, err := file.Stat()
+	return c.detectFaces(ctx, image, token)
+}
+
+// Token returns a valid access token, logging in to Face Cloud if needed.
+func (c *FaceCloudClient) Token(ctx context.Context) (token string, err error) {
+	return c.tokens.Token(ctx)
+}
+
+// detectFaces sends a request to the Face Cloud API to detect faces in images.
+func (c *FaceCloudClient) detectFaces(ctx context.Context, image []byte, token string) (b []byte, err error) {
+
+	url := fmt.Sprintf("%s/detect?demographics=true&attributes=true&landmarks=true&liveness=true&masks=true&quality=true", c.baseURL)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(image))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "image/jpeg")
 	req.Header.Set("Authorization", "Bearer "+token)
-	req.ContentLength = fileInfo.Size()
 
-	return reqUrl(req)
+	return c.reqUrl(req)
 }
 
 // Login sends a request to the Face Cloud API to obtain a JWT token.
-func Login(body []byte) (b []byte, err error) {
+func (c *FaceCloudClient) Login(ctx context.Context) (response *face_cloud_model.FaceCloudLoginResponse, err error) {
 
-	url := fmt.Sprintf("%s/login", os.Getenv(faceCloudApiUrlEnvName))
+	body, err := json.Marshal(face_cloud_model.FaceCloudLoginRequest{
+		Email:    c.email,
+		Password: c.password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/login", c.baseURL)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -53,30 +222,140 @@ func Login(body []byte) (b []byte, err error) {
 
 	req.Header.Set("Content-Type", "application/json")
 
-	return reqUrl(req)
+	data, err := c.reqUrl(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// process response data
+	if err = json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// login obtains a new access token for the token manager.
+func (c *FaceCloudClient) login(ctx context.Context) (token string, err error) {
+
+	response, err := c.Login(ctx)
+	if err != nil {
+		return token, err
+	}
+
+	if response.Data.AccessToken == "" {
+		return token, errors.New("face cloud returned empty access token")
+	}
+
+	return response.Data.AccessToken, nil
 }
 
 // reqUrl makes an HTTP request and returns the response and an error.
-func reqUrl(req *http.Request) (data []byte, err error) {
+// Temporary failures are retried according to the retry policy; returned errors are of type *RequestError,
+// unless the request context is done. Every attempt is subject to the rate limiter; the circuit breaker
+// lets the request through and records its outcome once, after the retries.
+func (c *FaceCloudClient) reqUrl(req *http.Request) (data []byte, err error) {
+
+	if !c.breaker.Allow() {
+		return nil, &RequestError{Kind: ErrProviderUnavailable}
+	}
 
-	client := &http.Client{Timeout: time.Second * time.Duration(10)}
+	data, err = c.retryRequest(req)
+
+	var reqErr *RequestError
+	switch {
+	case err == nil:
+		c.breaker.Success()
+	case req.Context().Err() != nil:
+		// cancelled by the caller, says nothing about the provider
+		c.breaker.Release()
+	case errors.As(err, &reqErr) && reqErr.Temporary():
+		c.breaker.Failure()
+	case errors.As(err, &reqErr):
+		// the provider is up, the request itself was rejected
+		c.breaker.Success()
+	default:
+		c.breaker.Release()
+	}
 
-	resp, err := client.Do(req)
+	return data, err
+}
+
+// retryRequest makes the HTTP request, retrying temporary failures according to the retry policy.
+func (c *FaceCloudClient) retryRequest(req *http.Request) (data []byte, err error) {
+
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		if err = c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		data, err = c.doRequest(req)
+		if err == nil {
+			return data, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) || !reqErr.Temporary() {
+			return nil, err
+		}
+
+		if attempt >= c.retry.MaxAttempts {
+			return nil, err
+		}
+
+		delay, ok := c.retry.backoff(attempt, reqErr.RetryAfter)
+		if !ok {
+			return nil, err
+		}
+
+		// the request body has to be rewound before sending it again
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		log.Printf("face cloud request failed, retrying in %v (attempt %d/%d): %v\n", delay, attempt, c.retry.MaxAttempts, reqErr)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// doRequest makes a single HTTP request and classifies its failure.
+func (c *FaceCloudClient) doRequest(req *http.Request) (data []byte, err error) {
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		log.Println(err)
-		return nil, err
+		return nil, &RequestError{Kind: ErrNetwork, Err: err}
 	}
 	defer resp.Body.Close()
 
 	data, err = io.ReadAll(resp.Body)
-
 	if err != nil {
-		log.Println(err)
-		return nil, err
+		return nil, &RequestError{Kind: ErrNetwork, Err: err}
 	}
 
 	if resp.StatusCode >= 400 && resp.StatusCode <= 599 {
-		return nil, errors.New("server returned error with status: " + resp.Status)
+		return nil, &RequestError{
+			Kind:       classifyStatus(resp.StatusCode),
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
 	return data, nil
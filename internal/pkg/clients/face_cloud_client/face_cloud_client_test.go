@@ -0,0 +1,161 @@
+package face_cloud_client_test
+
+import (
+	"context"
+	"errors"
+	"face-track/internal/pkg/clients/face_cloud_client"
+	"face-track/tools"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_FaceCloudClient_DetectFaces_Retry(t *testing.T) {
+
+	retry := face_cloud_client.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name         string
+		statuses     []int // statuses returned by the server for consecutive detect requests
+		wantAttempts int32
+		wantErrKind  error
+	}{
+		{
+			name:         "success after temporary failures",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			wantAttempts: 3,
+			wantErrKind:  face_cloud_client.ErrServer,
+		},
+		{
+			name:         "unsupported image is not retried",
+			statuses:     []int{http.StatusUnsupportedMediaType, http.StatusOK},
+			wantAttempts: 1,
+			wantErrKind:  face_cloud_client.ErrBadImage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/login" {
+					fmt.Fprint(w, `{"data":{"access_token":"token"},"status_code":200}`)
+					return
+				}
+				n := atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, retry, 0)
+
+			_, err := client.DetectFaces(context.Background(), []byte("image"))
+
+			if (err != nil) != (tt.wantErrKind != nil) {
+				t.Fatalf("DetectFaces() error = %v, want error kind %v", err, tt.wantErrKind)
+			}
+			if tt.wantErrKind != nil && !errors.Is(err, tt.wantErrKind) {
+				t.Errorf("DetectFaces() error = %v, want error kind %v", err, tt.wantErrKind)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func Test_FaceCloudClient_DetectFaces_CircuitBreaker(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		wantAttempts int32
+	}{
+		{
+			name:         "requests without retries",
+			maxAttempts:  1,
+			wantAttempts: 2,
+		},
+		{
+			// the breaker counts failed requests, not their attempts
+			name:         "requests with retries",
+			maxAttempts:  3,
+			wantAttempts: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/login" {
+					fmt.Fprint(w, `{"data":{"access_token":"token"},"status_code":200}`)
+					return
+				}
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			retry := face_cloud_client.RetryPolicy{
+				MaxAttempts: tt.maxAttempts,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    time.Millisecond,
+			}
+			client := newTestClient(t, server.URL, retry, 2)
+
+			var err error
+			for i := 0; i < 4; i++ {
+				_, err = client.DetectFaces(context.Background(), []byte("image"))
+			}
+
+			if !errors.Is(err, tools.ErrProviderUnavailable) {
+				t.Errorf("DetectFaces() error = %v, want %v", err, tools.ErrProviderUnavailable)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func Test_FaceCloudClient_DetectFaces_Cancel(t *testing.T) {
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			fmt.Fprint(w, `{"data":{"access_token":"token"},"status_code":200}`)
+			return
+		}
+		// never answer detect requests in time
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := newTestClient(t, server.URL, face_cloud_client.DefaultRetryPolicy(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.DetectFaces(ctx, []byte("image"))
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DetectFaces() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,68 @@
+package face_cloud_client
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures retries of temporary Face Cloud failures.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles on every next retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. A Retry-After longer than MaxDelay stops retrying.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used unless configured otherwise.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// backoff returns the jittered delay before the given retry (starting at 1),
+// or false if the request should not be retried anymore.
+func (p RetryPolicy) backoff(retry int, retryAfter time.Duration) (delay time.Duration, ok bool) {
+
+	if retryAfter > 0 {
+		return retryAfter, retryAfter <= p.MaxDelay
+	}
+
+	delay = p.BaseDelay << (retry - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+
+	// equal jitter: keep half of the delay and randomize the rest
+	half := delay / 2
+	if half > 0 {
+		delay = half + time.Duration(rand.Int63n(int64(half)))
+	}
+
+	return delay, true
+}
+
+// parseRetryAfter parses the Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,86 @@
+package face_cloud_client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin defines how long before expiry the access token is refreshed.
+const tokenRefreshMargin = time.Minute
+
+// tokenManager caches the Face Cloud access token and refreshes it before it expires.
+// It is safe for concurrent use.
+type tokenManager struct {
+	login func(ctx context.Context) (token string, err error)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// newTokenManager creates a new tokenManager obtaining tokens with the given login function.
+func newTokenManager(login func(ctx context.Context) (token string, err error)) *tokenManager {
+	return &tokenManager{
+		login: login,
+	}
+}
+
+// Token returns a valid access token, logging in to Face Cloud when there is no cached token
+// or the cached one is about to expire.
+func (m *tokenManager) Token(ctx context.Context) (token string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != "" && (m.expiresAt.IsZero() || time.Until(m.expiresAt) > tokenRefreshMargin) {
+		return m.token, nil
+	}
+
+	token, err = m.login(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	m.token = token
+	m.expiresAt = tokenExpiry(token)
+
+	return m.token, nil
+}
+
+// Invalidate drops the cached token if it is still the given one,
+// so the next Token call logs in again.
+func (m *tokenManager) Invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == token {
+		m.token = ""
+		m.expiresAt = time.Time{}
+	}
+}
+
+// tokenExpiry decodes the "exp" claim of the JWT; returns zero time if the token has no readable expiry.
+func tokenExpiry(token string) time.Time {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
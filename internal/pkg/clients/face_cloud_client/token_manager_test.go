@@ -0,0 +1,115 @@
+package face_cloud_client_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"face-track/internal/pkg/clients/face_cloud_client"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// makeToken builds an unsigned JWT with the given expiry.
+func makeToken(exp time.Time) string {
+	payload, _ := json.Marshal(map[string]int64{"exp": exp.Unix()})
+	return fmt.Sprintf("header.%s.signature", base64.RawURLEncoding.EncodeToString(payload))
+}
+
+// newTestClient creates a client for the test server without rate limits and retry delays.
+func newTestClient(t *testing.T, serverURL string, retry face_cloud_client.RetryPolicy, breakerThreshold int) *face_cloud_client.FaceCloudClient {
+	cfg := face_cloud_client.DefaultConfig()
+	cfg.BaseURL = serverURL
+	cfg.Email = "user@example.com"
+	cfg.Password = "pass"
+	cfg.Retry = retry
+	cfg.RateLimit = 0
+	cfg.BreakerThreshold = breakerThreshold
+	cfg.BreakerCooldown = time.Hour
+
+	client, err := face_cloud_client.New(cfg)
+	if err != nil {
+		t.Fatalf("face_cloud_client.New() error = %v", err)
+	}
+
+	return client
+}
+
+func Test_FaceCloudClient_Token(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		exp        time.Duration // token lifetime returned by login
+		wantLogins int32         // expected logins after two Token calls
+	}{
+		{
+			name:       "token is cached",
+			exp:        time.Hour,
+			wantLogins: 1,
+		},
+		{
+			name:       "token about to expire is refreshed",
+			exp:        time.Second,
+			wantLogins: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logins int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&logins, 1)
+				fmt.Fprintf(w, `{"data":{"access_token":"%s"},"status_code":200}`, makeToken(time.Now().Add(tt.exp)))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, face_cloud_client.RetryPolicy{MaxAttempts: 1}, 0)
+
+			for i := 0; i < 2; i++ {
+				if _, err := client.Token(context.Background()); err != nil {
+					t.Fatalf("FaceCloudClient.Token() error = %v", err)
+				}
+			}
+
+			if got := atomic.LoadInt32(&logins); got != tt.wantLogins {
+				t.Errorf("logins = %v, want %v", got, tt.wantLogins)
+			}
+		})
+	}
+}
+
+func Test_FaceCloudClient_DetectFaces_Relogin(t *testing.T) {
+
+	var logins, detects int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			n := atomic.AddInt32(&logins, 1)
+			fmt.Fprintf(w, `{"data":{"access_token":"token-%d"},"status_code":200}`, n)
+		case "/detect":
+			atomic.AddInt32(&detects, 1)
+			// only the token from the second login is accepted
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"data":[],"rotation":0,"status_code":200}`)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, face_cloud_client.RetryPolicy{MaxAttempts: 1}, 0)
+
+	if _, err := client.DetectFaces(context.Background(), []byte("image")); err != nil {
+		t.Fatalf("FaceCloudClient.DetectFaces() error = %v", err)
+	}
+
+	if logins != 2 || detects != 2 {
+		t.Errorf("logins = %v, detects = %v, want 2 and 2", logins, detects)
+	}
+}
@@ -0,0 +1,281 @@
+// Package face_cloud_fake provides an in-process fake of the Face Cloud API for tests and local development.
+// It serves the /login and /detect endpoints and returns deterministic detection results:
+// the same image always gets the same faces.
+package face_cloud_fake
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"face-track/internal/pkg/model/face_cloud_model"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the behaviour of the fake Face Cloud.
+type Config struct {
+	// Email and Password are the accepted credentials; any credentials are accepted if Email is empty.
+	Email    string
+	Password string
+	// TokenTTL is the lifetime of issued access tokens.
+	TokenTTL time.Duration
+	// FacesPerImage is the number of faces detected on every image.
+	FacesPerImage int
+	// Latency delays every response.
+	Latency time.Duration
+	// ErrorRate is the probability (0..1) of a detect request failing with 500.
+	ErrorRate float64
+}
+
+// DefaultConfig returns the default fake configuration.
+func DefaultConfig() Config {
+	return Config{
+		TokenTTL:      time.Hour,
+		FacesPerImage: 1,
+	}
+}
+
+// response is a scripted response returned instead of the regular one.
+type response struct {
+	status     int
+	retryAfter int
+}
+
+// FakeCloud is an http.Handler faking the Face Cloud API. It is safe for concurrent use.
+type FakeCloud struct {
+	cfg Config
+
+	mu      sync.Mutex
+	tokens  map[string]time.Time // issued tokens and their expiry
+	scripts []response           // responses for the next detect requests
+	logins  int
+	detects int
+	rand    *rand.Rand
+}
+
+// New creates a new FakeCloud with the given configuration.
+func New(cfg Config) *FakeCloud {
+	return &FakeCloud{
+		cfg:    cfg,
+		tokens: make(map[string]time.Time),
+		rand:   rand.New(rand.NewSource(1)),
+	}
+}
+
+// NewTestServer starts an httptest server running a FakeCloud; the caller must close the server.
+func NewTestServer(cfg Config) (fake *FakeCloud, server *httptest.Server) {
+	fake = New(cfg)
+	return fake, httptest.NewServer(fake)
+}
+
+// FailNext makes the next n detect requests fail with the given status.
+func (f *FakeCloud) FailNext(n int, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		f.scripts = append(f.scripts, response{status: status})
+	}
+}
+
+// RateLimitNext makes the next n detect requests fail with 429 and the given Retry-After in seconds.
+func (f *FakeCloud) RateLimitNext(n int, retryAfter int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		f.scripts = append(f.scripts, response{status: http.StatusTooManyRequests, retryAfter: retryAfter})
+	}
+}
+
+// ExpireTokens revokes all issued tokens, so the next detect requests get 401 until a new login.
+func (f *FakeCloud) ExpireTokens() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tokens = make(map[string]time.Time)
+}
+
+// Logins returns the number of successful logins.
+func (f *FakeCloud) Logins() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.logins
+}
+
+// Detects returns the number of received detect requests.
+func (f *FakeCloud) Detects() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.detects
+}
+
+// ServeHTTP routes the request to the faked endpoint.
+func (f *FakeCloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if f.cfg.Latency > 0 {
+		select {
+		case <-time.After(f.cfg.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/login"):
+		f.login(w, r)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/detect"):
+		f.detect(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": "not found", "status_code": http.StatusNotFound})
+	}
+}
+
+// login checks the credentials and issues an access token.
+func (f *FakeCloud) login(w http.ResponseWriter, r *http.Request) {
+
+	var request face_cloud_model.FaceCloudLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid request body", "status_code": http.StatusBadRequest})
+		return
+	}
+
+	if f.cfg.Email != "" && (request.Email != f.cfg.Email || request.Password != f.cfg.Password) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "invalid credentials", "status_code": http.StatusUnauthorized})
+		return
+	}
+
+	f.mu.Lock()
+	f.logins++
+	expiresAt := time.Now().Add(f.cfg.TokenTTL)
+	token := makeToken(f.logins, expiresAt)
+	f.tokens[token] = expiresAt
+	f.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, face_cloud_model.FaceCloudLoginResponse{
+		Data:       face_cloud_model.Data{AccessToken: token},
+		StatusCode: http.StatusOK,
+	})
+}
+
+// detect checks the token, applies injected errors and returns deterministic faces for the image.
+func (f *FakeCloud) detect(w http.ResponseWriter, r *http.Request) {
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	f.mu.Lock()
+	f.detects++
+	expiresAt, ok := f.tokens[token]
+	var script *response
+	if len(f.scripts) > 0 {
+		script = &f.scripts[0]
+		f.scripts = f.scripts[1:]
+	}
+	failed := f.cfg.ErrorRate > 0 && f.rand.Float64() < f.cfg.ErrorRate
+	f.mu.Unlock()
+
+	if !ok || time.Now().After(expiresAt) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "invalid token", "status_code": http.StatusUnauthorized})
+		return
+	}
+
+	if script != nil {
+		if script.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(script.retryAfter))
+		}
+		writeJSON(w, script.status, map[string]interface{}{"message": http.StatusText(script.status), "status_code": script.status})
+		return
+	}
+
+	if failed {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "injected error", "status_code": http.StatusInternalServerError})
+		return
+	}
+
+	image, err := io.ReadAll(r.Body)
+	if err != nil || len(image) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "image is required", "status_code": http.StatusBadRequest})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DetectResponse(image, f.cfg.FacesPerImage))
+}
+
+// DetectResponse returns the response the fake gives for the image; useful to build expectations in tests.
+func DetectResponse(image []byte, facesPerImage int) face_cloud_model.FaceCloudDetectResponse {
+
+	sum := sha256.Sum256(image)
+	seed := int64(binary.BigEndian.Uint64(sum[:8]))
+	rnd := rand.New(rand.NewSource(seed))
+
+	genders := []string{"male", "female"}
+	ethnicities := []string{"asian", "black", "indian", "white"}
+	options := []string{"none", "present"}
+
+	response := face_cloud_model.FaceCloudDetectResponse{
+		Data:       make([]face_cloud_model.FaceData, 0, facesPerImage),
+		StatusCode: http.StatusOK,
+	}
+
+	for i := 0; i < facesPerImage; i++ {
+		x, y := 50+i*150, 40+rnd.Intn(60)
+
+		response.Data = append(response.Data, face_cloud_model.FaceData{
+			Attributes: face_cloud_model.Attributes{
+				FacialHair: options[rnd.Intn(len(options))],
+				Glasses:    options[rnd.Intn(len(options))],
+				HairColor:  "brown",
+				HairType:   "straight",
+				Headwear:   options[rnd.Intn(len(options))],
+			},
+			Bbox: face_cloud_model.Bbox{Height: 120, Width: 100, X: x, Y: y},
+			Demographics: face_cloud_model.Demographics{
+				Age:       face_cloud_model.Age{Mean: float64(18 + rnd.Intn(50)), Variance: rnd.Float64() * 5},
+				Ethnicity: ethnicities[rnd.Intn(len(ethnicities))],
+				Gender:    genders[rnd.Intn(len(genders))],
+			},
+			Landmarks: []face_cloud_model.Landmark{
+				{X: x + 30, Y: y + 45},
+				{X: x + 70, Y: y + 45},
+				{X: x + 50, Y: y + 90},
+			},
+			Liveness: rnd.Intn(2),
+			Masks:    face_cloud_model.Masks{NoMask: 1},
+			Quality: face_cloud_model.Quality{
+				Blurriness:    rnd.Intn(100),
+				Overexposure:  rnd.Intn(100),
+				Underexposure: rnd.Intn(100),
+			},
+			Score: 0.9 + rnd.Float64()/10,
+		})
+	}
+
+	return response
+}
+
+// makeToken builds an unsigned JWT carrying the expiry, like the real service does.
+func makeToken(id int, expiresAt time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	header := encode([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := encode([]byte(fmt.Sprintf(`{"jti":%d,"exp":%d}`, id, expiresAt.Unix())))
+
+	return fmt.Sprintf("%s.%s.fake", header, payload)
+}
+
+// writeJSON writes the value as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,121 @@
+package face_cloud_fake_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"face-track/internal/pkg/clients/face_cloud_client"
+	"face-track/internal/pkg/clients/face_cloud_fake"
+	"face-track/internal/pkg/model/face_cloud_model"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_FakeCloud_Detect(t *testing.T) {
+
+	image := []byte("image")
+
+	tests := []struct {
+		name        string
+		beforeTest  func(*face_cloud_fake.FakeCloud)
+		wantErrKind error
+		wantLogins  int
+		wantDetects int
+	}{
+		{
+			name:        "success detect",
+			wantLogins:  1,
+			wantDetects: 1,
+		},
+		{
+			name: "rate limited detect is retried",
+			beforeTest: func(fake *face_cloud_fake.FakeCloud) {
+				fake.RateLimitNext(1, 0)
+			},
+			wantLogins:  1,
+			wantDetects: 2,
+		},
+		{
+			name: "unsupported image is not retried",
+			beforeTest: func(fake *face_cloud_fake.FakeCloud) {
+				fake.FailNext(1, http.StatusUnsupportedMediaType)
+			},
+			wantErrKind: face_cloud_client.ErrBadImage,
+			wantLogins:  1,
+			wantDetects: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := face_cloud_fake.NewTestServer(face_cloud_fake.DefaultConfig())
+			defer server.Close()
+
+			cfg := face_cloud_client.DefaultConfig()
+			cfg.BaseURL = server.URL
+			cfg.Retry = face_cloud_client.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+			client, err := face_cloud_client.New(cfg)
+			if err != nil {
+				t.Fatalf("face_cloud_client.New() error = %v", err)
+			}
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(fake)
+			}
+
+			data, err := client.DetectFaces(context.Background(), image)
+
+			if tt.wantErrKind != nil {
+				if !errors.Is(err, tt.wantErrKind) {
+					t.Errorf("DetectFaces() error = %v, want error kind %v", err, tt.wantErrKind)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("DetectFaces() error = %v", err)
+				}
+
+				var got face_cloud_model.FaceCloudDetectResponse
+				if err = json.Unmarshal(data, &got); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+
+				if want := face_cloud_fake.DetectResponse(image, 1); !reflect.DeepEqual(got, want) {
+					t.Errorf("DetectFaces() = %v, want %v", got, want)
+				}
+			}
+
+			if fake.Logins() != tt.wantLogins || fake.Detects() != tt.wantDetects {
+				t.Errorf("logins = %v, detects = %v, want %v and %v", fake.Logins(), fake.Detects(), tt.wantLogins, tt.wantDetects)
+			}
+		})
+	}
+}
+
+func Test_FakeCloud_ExpiredToken(t *testing.T) {
+
+	fake, server := face_cloud_fake.NewTestServer(face_cloud_fake.DefaultConfig())
+	defer server.Close()
+
+	cfg := face_cloud_client.DefaultConfig()
+	cfg.BaseURL = server.URL
+	client, err := face_cloud_client.New(cfg)
+	if err != nil {
+		t.Fatalf("face_cloud_client.New() error = %v", err)
+	}
+
+	if _, err = client.DetectFaces(context.Background(), []byte("image")); err != nil {
+		t.Fatalf("DetectFaces() error = %v", err)
+	}
+
+	fake.ExpireTokens()
+
+	if _, err = client.DetectFaces(context.Background(), []byte("image")); err != nil {
+		t.Fatalf("DetectFaces() after expired token error = %v", err)
+	}
+
+	if fake.Logins() != 2 {
+		t.Errorf("logins = %v, want 2", fake.Logins())
+	}
+}
@@ -0,0 +1,59 @@
+package face_cloud_fake
+
+import (
+	"face-track/tools"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const (
+	// fakeAddrEnvName is the env variable key for the fake Face Cloud server address.
+	fakeAddrEnvName = "FACE_CLOUD_FAKE__ADDRESS"
+
+	// fakeFacesEnvName is the env variable key for the number of faces detected on every image.
+	fakeFacesEnvName = "FACE_CLOUD_FAKE__FACES_PER_IMAGE"
+
+	// fakeLatencyEnvName is the env variable key for the delay of every response.
+	fakeLatencyEnvName = "FACE_CLOUD_FAKE__LATENCY"
+
+	// fakeErrorRateEnvName is the env variable key for the probability of a detect request failing.
+	fakeErrorRateEnvName = "FACE_CLOUD_FAKE__ERROR_RATE"
+
+	// faceCloudUserEnvName is the env variable key for the accepted user's email.
+	faceCloudUserEnvName = "FACE_CLOUD__API_USER"
+
+	// faceCloudPasswordEnvName is the env variable key for the accepted user's password.
+	faceCloudPasswordEnvName = "FACE_CLOUD__API_PASS"
+
+	// defaultAddr is the address the fake listens on unless configured otherwise.
+	defaultAddr = ":4222"
+)
+
+// NewServer initializes an HTTP server running the fake Face Cloud configured from the environment.
+func NewServer() *http.Server {
+
+	cfg := DefaultConfig()
+	cfg.Email = os.Getenv(faceCloudUserEnvName)
+	cfg.Password = os.Getenv(faceCloudPasswordEnvName)
+	cfg.FacesPerImage = tools.GetEnvInt(fakeFacesEnvName, cfg.FacesPerImage)
+	cfg.Latency = tools.GetEnvDuration(fakeLatencyEnvName, cfg.Latency)
+
+	if errorRate := os.Getenv(fakeErrorRateEnvName); errorRate != "" {
+		var err error
+		if cfg.ErrorRate, err = strconv.ParseFloat(errorRate, 64); err != nil {
+			log.Fatalf("env variable is not a number: %s", fakeErrorRateEnvName)
+		}
+	}
+
+	addr := os.Getenv(fakeAddrEnvName)
+	if addr == "" {
+		addr = defaultAddr
+	}
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: New(cfg),
+	}
+}
@@ -0,0 +1,22 @@
+ALTER TABLE face
+    DROP COLUMN IF EXISTS ethnicity,
+    DROP COLUMN IF EXISTS age_variance,
+    DROP COLUMN IF EXISTS score,
+    DROP COLUMN IF EXISTS liveness,
+
+    DROP COLUMN IF EXISTS facial_hair,
+    DROP COLUMN IF EXISTS glasses,
+    DROP COLUMN IF EXISTS hair_color,
+    DROP COLUMN IF EXISTS hair_type,
+    DROP COLUMN IF EXISTS headwear,
+
+    DROP COLUMN IF EXISTS mask_full_face,
+    DROP COLUMN IF EXISTS mask_lower_face,
+    DROP COLUMN IF EXISTS mask_none,
+    DROP COLUMN IF EXISTS mask_other,
+
+    DROP COLUMN IF EXISTS quality_blurriness,
+    DROP COLUMN IF EXISTS quality_overexposure,
+    DROP COLUMN IF EXISTS quality_underexposure,
+
+    DROP COLUMN IF EXISTS landmarks;
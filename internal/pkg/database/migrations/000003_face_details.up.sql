@@ -0,0 +1,22 @@
+ALTER TABLE face
+    ADD COLUMN IF NOT EXISTS ethnicity TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS age_variance REAL NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS score REAL NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS liveness SMALLINT NOT NULL DEFAULT 0,
+
+    ADD COLUMN IF NOT EXISTS facial_hair TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS glasses TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS hair_color TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS hair_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS headwear TEXT NOT NULL DEFAULT '',
+
+    ADD COLUMN IF NOT EXISTS mask_full_face SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mask_lower_face SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mask_none SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mask_other SMALLINT NOT NULL DEFAULT 0,
+
+    ADD COLUMN IF NOT EXISTS quality_blurriness SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS quality_overexposure SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS quality_underexposure SMALLINT NOT NULL DEFAULT 0,
+
+    ADD COLUMN IF NOT EXISTS landmarks JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS image_response (
+    id SERIAL PRIMARY KEY,
+    image_id INT NOT NULL UNIQUE,
+
+    provider TEXT NOT NULL,
+    rotation INT NOT NULL DEFAULT 0,
+    response JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    FOREIGN KEY (image_id) REFERENCES task_image (id) ON DELETE CASCADE
+);
+
+ALTER TABLE IF EXISTS public.image_response OWNER to "face-track";
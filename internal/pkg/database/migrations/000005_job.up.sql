@@ -0,0 +1,25 @@
+CREATE TYPE job_status AS ENUM ('queued', 'running', 'done', 'failed');
+
+CREATE TABLE IF NOT EXISTS job (
+    id SERIAL PRIMARY KEY,
+    task_id INT NOT NULL,
+
+    kind TEXT NOT NULL,
+    job_status job_status NOT NULL DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+
+    run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    FOREIGN KEY (task_id) REFERENCES task (id) ON DELETE CASCADE
+);
+
+-- a task has at most one active job
+CREATE UNIQUE INDEX IF NOT EXISTS job_active_task_idx ON job (task_id) WHERE job_status IN ('queued', 'running');
+
+CREATE INDEX IF NOT EXISTS job_queued_idx ON job (run_at, id) WHERE job_status = 'queued';
+
+ALTER TABLE IF EXISTS public.job OWNER to "face-track";
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS task_in_progress_idx;
+
+ALTER TABLE task
+    DROP COLUMN IF EXISTS lease_owner,
+    DROP COLUMN IF EXISTS lease_expires_at;
@@ -0,0 +1,5 @@
+ALTER TABLE task
+    ADD COLUMN IF NOT EXISTS lease_owner TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS task_in_progress_idx ON task (lease_expires_at) WHERE task_status = 'in_progress';
@@ -0,0 +1,25 @@
+-- enum values cannot be dropped, so the types are recreated without them
+UPDATE task SET task_status='error' WHERE task_status='cancelled';
+UPDATE job SET job_status='failed' WHERE job_status='cancelled';
+
+DROP INDEX IF EXISTS task_in_progress_idx;
+DROP INDEX IF EXISTS job_active_task_idx;
+DROP INDEX IF EXISTS job_queued_idx;
+
+ALTER TYPE task_status RENAME TO task_status_old;
+CREATE TYPE task_status AS ENUM ('new', 'in_progress', 'completed', 'error');
+ALTER TABLE task ALTER COLUMN task_status DROP DEFAULT;
+ALTER TABLE task ALTER COLUMN task_status TYPE task_status USING task_status::text::task_status;
+ALTER TABLE task ALTER COLUMN task_status SET DEFAULT 'new';
+DROP TYPE task_status_old;
+
+ALTER TYPE job_status RENAME TO job_status_old;
+CREATE TYPE job_status AS ENUM ('queued', 'running', 'done', 'failed');
+ALTER TABLE job ALTER COLUMN job_status DROP DEFAULT;
+ALTER TABLE job ALTER COLUMN job_status TYPE job_status USING job_status::text::job_status;
+ALTER TABLE job ALTER COLUMN job_status SET DEFAULT 'queued';
+DROP TYPE job_status_old;
+
+CREATE INDEX IF NOT EXISTS task_in_progress_idx ON task (lease_expires_at) WHERE task_status = 'in_progress';
+CREATE UNIQUE INDEX IF NOT EXISTS job_active_task_idx ON job (task_id) WHERE job_status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS job_queued_idx ON job (run_at, id) WHERE job_status = 'queued';
@@ -0,0 +1,2 @@
+ALTER TYPE task_status ADD VALUE IF NOT EXISTS 'cancelled';
+ALTER TYPE job_status ADD VALUE IF NOT EXISTS 'cancelled';
@@ -0,0 +1,24 @@
+ALTER TABLE task_image ADD COLUMN IF NOT EXISTS done boolean NOT NULL DEFAULT false;
+
+UPDATE task_image SET done=true WHERE image_status='done';
+
+ALTER TABLE task_image
+    DROP COLUMN IF EXISTS image_status,
+    DROP COLUMN IF EXISTS error,
+    DROP COLUMN IF EXISTS attempts;
+
+DROP TYPE IF EXISTS image_status;
+
+-- enum values cannot be dropped, so the type is recreated without it
+UPDATE task SET task_status='completed' WHERE task_status='completed_with_errors';
+
+DROP INDEX IF EXISTS task_in_progress_idx;
+
+ALTER TYPE task_status RENAME TO task_status_old;
+CREATE TYPE task_status AS ENUM ('new', 'in_progress', 'completed', 'error', 'cancelled');
+ALTER TABLE task ALTER COLUMN task_status DROP DEFAULT;
+ALTER TABLE task ALTER COLUMN task_status TYPE task_status USING task_status::text::task_status;
+ALTER TABLE task ALTER COLUMN task_status SET DEFAULT 'new';
+DROP TYPE task_status_old;
+
+CREATE INDEX IF NOT EXISTS task_in_progress_idx ON task (lease_expires_at) WHERE task_status = 'in_progress';
@@ -0,0 +1,12 @@
+CREATE TYPE image_status AS ENUM ('pending', 'done', 'failed');
+
+ALTER TABLE task_image
+    ADD COLUMN IF NOT EXISTS image_status image_status NOT NULL DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+
+UPDATE task_image SET image_status='done', attempts=1 WHERE done;
+
+ALTER TABLE task_image DROP COLUMN IF EXISTS done;
+
+ALTER TYPE task_status ADD VALUE IF NOT EXISTS 'completed_with_errors';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TYPE IF EXISTS delivery_status;
+
+ALTER TABLE task DROP COLUMN IF EXISTS callback_url;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS task_status_idx;
+DROP INDEX IF EXISTS task_faces_total_idx;
+DROP INDEX IF EXISTS task_updated_at_idx;
+DROP INDEX IF EXISTS task_created_at_idx;
+
+DROP TRIGGER IF EXISTS task_updated_at ON task;
+DROP FUNCTION IF EXISTS task_set_updated_at();
+
+ALTER TABLE task
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,22 @@
+ALTER TABLE task
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- updated_at follows changes of the task data; worker lease renewals are not such changes
+CREATE OR REPLACE FUNCTION task_set_updated_at() RETURNS trigger AS $$
+BEGIN
+    IF to_jsonb(NEW) - 'lease_owner' - 'lease_expires_at' - 'updated_at'
+        IS DISTINCT FROM to_jsonb(OLD) - 'lease_owner' - 'lease_expires_at' - 'updated_at' THEN
+        NEW.updated_at = now();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_updated_at BEFORE UPDATE ON task
+    FOR EACH ROW EXECUTE FUNCTION task_set_updated_at();
+
+CREATE INDEX IF NOT EXISTS task_created_at_idx ON task (created_at, id);
+CREATE INDEX IF NOT EXISTS task_updated_at_idx ON task (updated_at, id);
+CREATE INDEX IF NOT EXISTS task_faces_total_idx ON task (faces_total, id);
+CREATE INDEX IF NOT EXISTS task_status_idx ON task (task_status);
@@ -0,0 +1,3 @@
+ALTER TABLE task_image
+    DROP COLUMN IF EXISTS image_format,
+    DROP COLUMN IF EXISTS original_name;
@@ -0,0 +1,3 @@
+ALTER TABLE task_image
+    ADD COLUMN IF NOT EXISTS image_format TEXT NOT NULL DEFAULT 'jpeg',
+    ADD COLUMN IF NOT EXISTS original_name TEXT NOT NULL DEFAULT '';
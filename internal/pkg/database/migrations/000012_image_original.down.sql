@@ -0,0 +1,8 @@
+ALTER TABLE task_image ADD COLUMN IF NOT EXISTS original_name TEXT NOT NULL DEFAULT '';
+
+UPDATE task_image SET original_name=image_name, image_name=rendition_name WHERE image_name<>rendition_name;
+
+ALTER TABLE task_image
+    DROP COLUMN IF EXISTS rendition_name,
+    DROP COLUMN IF EXISTS checksum,
+    DROP COLUMN IF EXISTS size_bytes;
@@ -0,0 +1,10 @@
+ALTER TABLE task_image
+    ADD COLUMN IF NOT EXISTS rendition_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- image_name becomes the uploaded file; the JPEG sent to the detector is the rendition
+UPDATE task_image SET rendition_name=image_name;
+UPDATE task_image SET image_name=original_name WHERE original_name<>'';
+
+ALTER TABLE task_image DROP COLUMN IF EXISTS original_name;
@@ -0,0 +1,4 @@
+ALTER TABLE task_image
+    DROP COLUMN IF EXISTS orientation,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS height;
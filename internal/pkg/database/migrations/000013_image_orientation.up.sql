@@ -0,0 +1,4 @@
+ALTER TABLE task_image
+    ADD COLUMN IF NOT EXISTS orientation SMALLINT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS detection_cache;
+DROP TABLE IF EXISTS image_blob;
+
+DROP INDEX IF EXISTS task_image_checksum_idx;
+
+ALTER TABLE task_image ADD COLUMN IF NOT EXISTS rendition_name TEXT NOT NULL DEFAULT '';
+
+UPDATE task_image SET rendition_name = regexp_replace(rendition_key, '^.*/', '');
+
+ALTER TABLE task_image
+    DROP COLUMN IF EXISTS original_key,
+    DROP COLUMN IF EXISTS rendition_key;
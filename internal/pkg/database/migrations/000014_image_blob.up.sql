@@ -0,0 +1,39 @@
+ALTER TABLE task_image
+    ADD COLUMN IF NOT EXISTS original_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rendition_key TEXT NOT NULL DEFAULT '';
+
+-- files uploaded earlier stay under the task prefix and are deleted with the task
+UPDATE task_image SET
+    original_key = (task_id % 30000) || '/' || task_id || '/' || image_name,
+    rendition_key = (task_id % 30000) || '/' || task_id || '/' || rendition_name;
+
+ALTER TABLE task_image DROP COLUMN IF EXISTS rendition_name;
+
+CREATE INDEX IF NOT EXISTS task_image_checksum_idx ON task_image (checksum);
+
+-- content-addressed files shared by images of the same content
+CREATE TABLE IF NOT EXISTS image_blob (
+    checksum TEXT PRIMARY KEY,
+
+    original_key TEXT NOT NULL,
+    rendition_key TEXT NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    stored BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE IF EXISTS public.image_blob OWNER to "face-track";
+
+-- detection results reused for images of the same content
+CREATE TABLE IF NOT EXISTS detection_cache (
+    checksum TEXT NOT NULL,
+    provider TEXT NOT NULL,
+
+    rotation INT NOT NULL DEFAULT 0,
+    response JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (checksum, provider)
+);
+
+ALTER TABLE IF EXISTS public.detection_cache OWNER to "face-track";
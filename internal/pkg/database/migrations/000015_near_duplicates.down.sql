@@ -0,0 +1,3 @@
+ALTER TABLE task DROP COLUMN IF EXISTS exclude_duplicates;
+
+ALTER TABLE task_image DROP COLUMN IF EXISTS dhash;
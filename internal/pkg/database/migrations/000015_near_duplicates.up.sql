@@ -0,0 +1,3 @@
+ALTER TABLE task_image ADD COLUMN IF NOT EXISTS dhash TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE task ADD COLUMN IF NOT EXISTS exclude_duplicates BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS task_owner_idx ON task (owner);
@@ -0,0 +1,57 @@
+// Package detector provides a pluggable face detection backend.
+// The backend is selected by configuration, so the rest of the app does not depend on a specific provider.
+package detector
+
+import (
+	"context"
+	"face-track/internal/pkg/detector/face_cloud_detector"
+	"face-track/internal/pkg/detector/fake_detector"
+	"face-track/internal/pkg/model/detector_model"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// detectorEnvName is the env variable key for the face detection backend name.
+	detectorEnvName = "FACE_TRACK__DETECTOR"
+
+	// FaceCloud is the name of the Tevian Face Cloud backend.
+	FaceCloud = face_cloud_detector.Name
+
+	// Fake is the name of the local fake backend.
+	Fake = fake_detector.Name
+)
+
+// Detector defines the interface for face detection backends.
+type Detector interface {
+	// Name returns the backend name stored along with raw responses.
+	Name() string
+	// Detect detects faces on the image.
+	Detect(ctx context.Context, image io.Reader, size int64) (result *detector_model.DetectResult, err error)
+	// Parse rebuilds the detection result from a raw response previously returned by Detect.
+	Parse(raw []byte) (result *detector_model.DetectResult, err error)
+}
+
+// NewDetector creates the face detection backend selected by the FACE_TRACK__DETECTOR env variable.
+// Face Cloud is used when the variable is not set.
+func NewDetector() (d Detector, err error) {
+
+	name := os.Getenv(detectorEnvName)
+	if name == "" {
+		name = FaceCloud
+	}
+
+	switch name {
+	case FaceCloud:
+		faceCloudDetector, err := face_cloud_detector.New()
+		if err != nil {
+			return nil, err
+		}
+		return faceCloudDetector, nil
+	case Fake:
+		return fake_detector.New(fake_detector.DefaultFacesPerImage), nil
+	default:
+		return nil, fmt.Errorf("unknown face detector: %s", name)
+	}
+}
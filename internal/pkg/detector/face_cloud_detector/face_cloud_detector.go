@@ -0,0 +1,199 @@
+// Package face_cloud_detector implements face detection backed by the Tevian Face Cloud API.
+package face_cloud_detector
+
+import (
+	"context"
+	"encoding/json"
+	"face-track/internal/pkg/clients/face_cloud_client"
+	"face-track/internal/pkg/model/detector_model"
+	"face-track/internal/pkg/model/face_cloud_model"
+	"face-track/tools"
+	"io"
+	"os"
+)
+
+const (
+	// Name is the backend name of the detector.
+	Name = "face_cloud"
+
+	// faceCloudApiUrlEnvName is the env variable key for the Face Cloud API URL.
+	faceCloudApiUrlEnvName = "FACE_CLOUD__API_URL"
+
+	// faceCloudUserEnvName is the env variable key for the Face Cloud API user's email.
+	faceCloudUserEnvName = "FACE_CLOUD__API_USER"
+
+	// faceCloudPasswordEnvName is the env variable key for the Face Cloud API user's password.
+	faceCloudPasswordEnvName = "FACE_CLOUD__API_PASS"
+
+	// faceCloudTimeoutEnvName is the env variable key for the timeout of a single request.
+	faceCloudTimeoutEnvName = "FACE_CLOUD__TIMEOUT"
+
+	// faceCloudMaxIdleConnsEnvName is the env variable key for the maximum number of idle connections.
+	faceCloudMaxIdleConnsEnvName = "FACE_CLOUD__MAX_IDLE_CONNS"
+
+	// faceCloudProxyUrlEnvName is the env variable key for the proxy used for Face Cloud requests.
+	faceCloudProxyUrlEnvName = "FACE_CLOUD__PROXY_URL"
+
+	// faceCloudTlsCaFileEnvName is the env variable key for a PEM file with additional root certificates.
+	faceCloudTlsCaFileEnvName = "FACE_CLOUD__TLS_CA_FILE"
+
+	// faceCloudTlsInsecureEnvName is the env variable key disabling server certificate verification.
+	faceCloudTlsInsecureEnvName = "FACE_CLOUD__TLS_INSECURE_SKIP_VERIFY"
+
+	// faceCloudRetryAttemptsEnvName is the env variable key for the maximum number of attempts per request.
+	faceCloudRetryAttemptsEnvName = "FACE_CLOUD__RETRY_MAX_ATTEMPTS"
+
+	// faceCloudRetryBaseDelayEnvName is the env variable key for the delay before the first retry.
+	faceCloudRetryBaseDelayEnvName = "FACE_CLOUD__RETRY_BASE_DELAY"
+
+	// faceCloudRetryMaxDelayEnvName is the env variable key for the maximum delay between retries.
+	faceCloudRetryMaxDelayEnvName = "FACE_CLOUD__RETRY_MAX_DELAY"
+
+	// faceCloudRateLimitEnvName is the env variable key for the maximum number of requests per second.
+	faceCloudRateLimitEnvName = "FACE_CLOUD__RATE_LIMIT"
+
+	// faceCloudRateBurstEnvName is the env variable key for the maximum burst of requests.
+	faceCloudRateBurstEnvName = "FACE_CLOUD__RATE_BURST"
+
+	// faceCloudBreakerThresholdEnvName is the env variable key for the number of failed requests opening the circuit breaker;
+	// a request fails once its retries are exhausted.
+	faceCloudBreakerThresholdEnvName = "FACE_CLOUD__BREAKER_THRESHOLD"
+
+	// faceCloudBreakerCooldownEnvName is the env variable key for how long the circuit breaker stays open.
+	faceCloudBreakerCooldownEnvName = "FACE_CLOUD__BREAKER_COOLDOWN"
+)
+
+// FaceCloudDetector detects faces using the Face Cloud API.
+type FaceCloudDetector struct {
+	client *face_cloud_client.FaceCloudClient
+}
+
+// New creates a new FaceCloudDetector configured from the environment.
+func New() (d *FaceCloudDetector, err error) {
+
+	client, err := face_cloud_client.New(configFromEnv())
+	if err != nil {
+		return nil, err
+	}
+
+	return &FaceCloudDetector{
+		client: client,
+	}, nil
+}
+
+// configFromEnv reads the Face Cloud client configuration from the environment.
+func configFromEnv() face_cloud_client.Config {
+	tools.CheckEnvs(faceCloudApiUrlEnvName, faceCloudUserEnvName, faceCloudPasswordEnvName)
+
+	cfg := face_cloud_client.DefaultConfig()
+
+	cfg.BaseURL = os.Getenv(faceCloudApiUrlEnvName)
+	cfg.Email = os.Getenv(faceCloudUserEnvName)
+	cfg.Password = os.Getenv(faceCloudPasswordEnvName)
+
+	cfg.Timeout = tools.GetEnvDuration(faceCloudTimeoutEnvName, cfg.Timeout)
+	cfg.MaxIdleConns = tools.GetEnvInt(faceCloudMaxIdleConnsEnvName, cfg.MaxIdleConns)
+	cfg.ProxyURL = os.Getenv(faceCloudProxyUrlEnvName)
+	cfg.TLSCAFile = os.Getenv(faceCloudTlsCaFileEnvName)
+	cfg.TLSInsecureSkipVerify = tools.GetEnvBool(faceCloudTlsInsecureEnvName, false)
+
+	cfg.Retry.MaxAttempts = tools.GetEnvInt(faceCloudRetryAttemptsEnvName, cfg.Retry.MaxAttempts)
+	cfg.Retry.BaseDelay = tools.GetEnvDuration(faceCloudRetryBaseDelayEnvName, cfg.Retry.BaseDelay)
+	cfg.Retry.MaxDelay = tools.GetEnvDuration(faceCloudRetryMaxDelayEnvName, cfg.Retry.MaxDelay)
+
+	cfg.RateLimit = tools.GetEnvFloat(faceCloudRateLimitEnvName, cfg.RateLimit)
+	cfg.RateBurst = tools.GetEnvInt(faceCloudRateBurstEnvName, cfg.RateBurst)
+	cfg.BreakerThreshold = tools.GetEnvInt(faceCloudBreakerThresholdEnvName, cfg.BreakerThreshold)
+	cfg.BreakerCooldown = tools.GetEnvDuration(faceCloudBreakerCooldownEnvName, cfg.BreakerCooldown)
+
+	return cfg
+}
+
+// Name returns the backend name of the detector.
+func (d *FaceCloudDetector) Name() string {
+	return Name
+}
+
+// Detect sends the image to Face Cloud and returns the detected faces.
+func (d *FaceCloudDetector) Detect(ctx context.Context, image io.Reader, size int64) (result *detector_model.DetectResult, err error) {
+
+	imageBytes, err := io.ReadAll(image)
+	if err != nil {
+		return nil, err
+	}
+
+	// send request
+	data, err := d.client.DetectFaces(ctx, imageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Parse(data)
+}
+
+// Parse converts a raw Face Cloud detect response to the detection result.
+func (d *FaceCloudDetector) Parse(raw []byte) (result *detector_model.DetectResult, err error) {
+
+	var response face_cloud_model.FaceCloudDetectResponse
+	if err = json.Unmarshal(raw, &response); err != nil {
+		return nil, err
+	}
+
+	result = normalize(&response)
+	result.Raw = raw
+
+	return result, nil
+}
+
+// normalize converts the Face Cloud response to a provider independent result.
+func normalize(response *face_cloud_model.FaceCloudDetectResponse) (result *detector_model.DetectResult) {
+
+	result = &detector_model.DetectResult{
+		Faces:    make([]*detector_model.Face, 0, len(response.Data)),
+		Rotation: response.Rotation,
+	}
+
+	for _, faceData := range response.Data {
+		face := &detector_model.Face{
+			Gender:      faceData.Demographics.Gender,
+			Age:         faceData.Demographics.Age.Mean,
+			AgeVariance: faceData.Demographics.Age.Variance,
+			Ethnicity:   faceData.Demographics.Ethnicity,
+			Bbox: detector_model.Bbox{
+				Height: faceData.Bbox.Height,
+				Width:  faceData.Bbox.Width,
+				X:      faceData.Bbox.X,
+				Y:      faceData.Bbox.Y,
+			},
+			Score:    faceData.Score,
+			Liveness: faceData.Liveness,
+			Attributes: detector_model.Attributes{
+				FacialHair: faceData.Attributes.FacialHair,
+				Glasses:    faceData.Attributes.Glasses,
+				HairColor:  faceData.Attributes.HairColor,
+				HairType:   faceData.Attributes.HairType,
+				Headwear:   faceData.Attributes.Headwear,
+			},
+			Landmarks: make([]detector_model.Landmark, 0, len(faceData.Landmarks)),
+			Masks: detector_model.Masks{
+				FullFace:  faceData.Masks.FullFaceMask,
+				LowerFace: faceData.Masks.LowerFaceMask,
+				None:      faceData.Masks.NoMask,
+				Other:     faceData.Masks.OtherMask,
+			},
+			Quality: detector_model.Quality{
+				Blurriness:    faceData.Quality.Blurriness,
+				Overexposure:  faceData.Quality.Overexposure,
+				Underexposure: faceData.Quality.Underexposure,
+			},
+		}
+
+		for _, landmark := range faceData.Landmarks {
+			face.Landmarks = append(face.Landmarks, detector_model.Landmark{X: landmark.X, Y: landmark.Y})
+		}
+
+		result.Faces = append(result.Faces, face)
+	}
+
+	return result
+}
@@ -0,0 +1,87 @@
+// Package fake_detector implements a local face detection backend that returns deterministic faces.
+// It is meant for development and tests, when no real provider is available.
+package fake_detector
+
+import (
+	"context"
+	"encoding/json"
+	"face-track/internal/pkg/model/detector_model"
+	"io"
+)
+
+const (
+	// Name is the backend name of the detector.
+	Name = "fake"
+
+	// DefaultFacesPerImage is the number of faces reported for every image by default.
+	DefaultFacesPerImage = 1
+)
+
+// FakeDetector reports the same set of faces for every image.
+type FakeDetector struct {
+	facesPerImage int
+}
+
+// New creates a new FakeDetector reporting the given number of faces per image.
+func New(facesPerImage int) *FakeDetector {
+	return &FakeDetector{
+		facesPerImage: facesPerImage,
+	}
+}
+
+// Name returns the backend name of the detector.
+func (d *FakeDetector) Name() string {
+	return Name
+}
+
+// Detect reads the image and returns deterministic faces, alternating gender.
+func (d *FakeDetector) Detect(ctx context.Context, image io.Reader, size int64) (result *detector_model.DetectResult, err error) {
+
+	if _, err = io.Copy(io.Discard, image); err != nil {
+		return nil, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result = &detector_model.DetectResult{
+		Faces: make([]*detector_model.Face, 0, d.facesPerImage),
+	}
+
+	for i := 0; i < d.facesPerImage; i++ {
+		gender := "male"
+		if i%2 == 1 {
+			gender = "female"
+		}
+
+		result.Faces = append(result.Faces, &detector_model.Face{
+			Gender: gender,
+			Age:    float64(30 + i),
+			Bbox: detector_model.Bbox{
+				Height: 100,
+				Width:  100,
+				X:      i * 100,
+				Y:      0,
+			},
+		})
+	}
+
+	// the normalized result itself serves as the raw response
+	if result.Raw, err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Parse rebuilds the detection result from a raw response returned by Detect.
+func (d *FakeDetector) Parse(raw []byte) (result *detector_model.DetectResult, err error) {
+
+	if err = json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	result.Raw = raw
+
+	return result, nil
+}
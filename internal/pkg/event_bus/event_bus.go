@@ -0,0 +1,81 @@
+// Package event_bus provides an in-process publish/subscribe bus for task progress events.
+package event_bus
+
+import (
+	"face-track/internal/pkg/model/event_model"
+	"sync"
+)
+
+// subscriberBuffer is the number of events kept for a subscriber that does not keep up.
+// One more slot is reserved for the final status event, so it is never dropped.
+const subscriberBuffer = 64
+
+// EventBus delivers events published for a task to all its subscribers.
+// Events are delivered only to subscribers of the same app instance, so the events of a task processed
+// by another instance are not delivered. A slow subscriber does not block the publisher: when its buffer
+// is full, its channel is closed, so the client reconnects and starts over with the current task status.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan *event_model.Event]struct{}
+}
+
+// New creates a new EventBus.
+func New() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]map[chan *event_model.Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving events of the task and a function
+// to unsubscribe and close the channel.
+func (b *EventBus) Subscribe(taskId int) (events <-chan *event_model.Event, unsubscribe func()) {
+	ch := make(chan *event_model.Event, subscriberBuffer+1)
+
+	b.mu.Lock()
+	if b.subscribers[taskId] == nil {
+		b.subscribers[taskId] = make(map[chan *event_model.Event]struct{})
+	}
+	b.subscribers[taskId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		// the channel is closed already if the subscriber has been dropped
+		if _, ok := b.subscribers[taskId][ch]; ok {
+			b.drop(taskId, ch)
+		}
+	}
+}
+
+// Publish sends the event to the subscribers of its task. A subscriber with a full buffer is dropped
+// and its channel is closed; the final status event may use the reserved slot.
+func (b *EventBus) Publish(event *event_model.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	limit := subscriberBuffer
+	if status, ok := event.Data.(event_model.Status); ok && event_model.IsFinalStatus(status.Status) {
+		limit++
+	}
+
+	for ch := range b.subscribers[event.TaskId] {
+		if len(ch) >= limit {
+			b.drop(event.TaskId, ch)
+			continue
+		}
+
+		ch <- event
+	}
+}
+
+// drop removes the subscriber of the task and closes its channel; the caller holds the lock.
+func (b *EventBus) drop(taskId int, ch chan *event_model.Event) {
+	delete(b.subscribers[taskId], ch)
+	if len(b.subscribers[taskId]) == 0 {
+		delete(b.subscribers, taskId)
+	}
+
+	close(ch)
+}
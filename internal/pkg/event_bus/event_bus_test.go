@@ -0,0 +1,103 @@
+package event_bus_test
+
+import (
+	"face-track/internal/pkg/event_bus"
+	"face-track/internal/pkg/model/event_model"
+	"testing"
+)
+
+func Test_EventBus_Publish(t *testing.T) {
+
+	bus := event_bus.New()
+
+	events, unsubscribe := bus.Subscribe(1)
+	other, unsubscribeOther := bus.Subscribe(2)
+	defer unsubscribeOther()
+
+	bus.Publish(event_model.NewEvent(event_model.TypeStatus, 1, event_model.Status{Status: "completed"}))
+
+	select {
+	case event := <-events:
+		if event.Type != event_model.TypeStatus || event.TaskId != 1 {
+			t.Errorf("eventBus.Publish() delivered %v, want status event of task 1", event)
+		}
+	default:
+		t.Errorf("eventBus.Publish() did not deliver the event")
+	}
+
+	select {
+	case event := <-other:
+		t.Errorf("eventBus.Publish() delivered %v to subscriber of another task", event)
+	default:
+	}
+
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Errorf("unsubscribe() did not close the channel")
+	}
+
+	// publishing without subscribers must not block
+	bus.Publish(event_model.NewEvent(event_model.TypeStatus, 1, event_model.Status{Status: "error"}))
+}
+
+func Test_EventBus_SlowSubscriber(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		published int  // Number of progress events published before the final status
+		final     bool // Whether the final status event is published
+		want      int  // Number of events received before the channel is closed
+		wantFinal bool // Whether the last received event is the final status
+	}{
+		{
+			name:      "final status uses the reserved slot",
+			published: 64,
+			final:     true,
+			want:      65,
+			wantFinal: true,
+		},
+		{
+			name:      "overflow drops the subscriber",
+			published: 1000,
+			final:     true,
+			want:      64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := event_bus.New()
+
+			events, unsubscribe := bus.Subscribe(1)
+			defer unsubscribe()
+
+			// a subscriber that does not read must not block the publisher
+			for i := 0; i < tt.published; i++ {
+				bus.Publish(event_model.NewEvent(event_model.TypeFacesFound, 1, event_model.FacesFound{Faces: i}))
+			}
+			if tt.final {
+				bus.Publish(event_model.NewEvent(event_model.TypeStatus, 1, event_model.Status{Status: "completed"}))
+			}
+
+			// the subscriber is dropped on the next event either way
+			bus.Publish(event_model.NewEvent(event_model.TypeFacesFound, 1, event_model.FacesFound{}))
+
+			var got int
+			var last *event_model.Event
+			for event := range events {
+				got++
+				last = event
+			}
+
+			if got != tt.want {
+				t.Errorf("eventBus.Publish() delivered %d events, want %d", got, tt.want)
+			}
+
+			if isFinal := last != nil && last.Type == event_model.TypeStatus; isFinal != tt.wantFinal {
+				t.Errorf("eventBus.Publish() delivered final status last = %v, want %v", isFinal, tt.wantFinal)
+			}
+		})
+	}
+}
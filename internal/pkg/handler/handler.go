@@ -2,7 +2,10 @@
 package handler
 
 import (
+	"errors"
 	"face-track/internal/pkg/service"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 
@@ -11,22 +14,52 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// serverAddrName is an env variable key for the Face Track server address.
-const serverAddrName = "FACE_TRACK__SERVER_ADDRESS"
+const (
+	// serverAddrName is an env variable key for the Face Track server address.
+	serverAddrName = "FACE_TRACK__SERVER_ADDRESS"
+
+	// uploadMaxBytesEnvName is an env variable key for the largest request body uploading images or archives.
+	uploadMaxBytesEnvName = "FACE_TRACK__UPLOAD_MAX_BYTES"
+)
 
 // Handler is responsible for handling incoming HTTP requests and routing them
 // to the appropriate service methods.
 type Handler struct {
-	service *service.Service
+	service        *service.Service
+	uploadMaxBytes int64
 }
 
 // NewHandler returns a new Handler instance.
 func NewHandler(service *service.Service) *Handler {
 	return &Handler{
-		service: service,
+		service:        service,
+		uploadMaxBytes: int64(tools.GetEnvInt(uploadMaxBytesEnvName, 64<<20)),
 	}
 }
 
+// limitBody limits the request body to the given number of bytes;
+// reading past the limit fails with tools.ErrTooLarge.
+func limitBody(c *gin.Context, limit int64) {
+	c.Request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit)}
+}
+
+// limitedBody is a request body limited by http.MaxBytesReader.
+type limitedBody struct {
+	io.ReadCloser
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		err = fmt.Errorf("%w: request body exceeds %d bytes", tools.ErrTooLarge, maxBytesErr.Limit)
+	}
+
+	return n, err
+}
+
 // NewServer initializes and returns an HTTP server.
 func NewServer(s *service.Service) *http.Server {
 	tools.CheckEnvs(serverAddrName)
@@ -2,26 +2,49 @@ package handler
 
 import (
 	"errors"
+	"face-track/internal/pkg/imaging"
 	"face-track/internal/pkg/middleware"
+	"face-track/internal/pkg/model/event_model"
 	"face-track/internal/pkg/model/task_model"
 	"face-track/tools"
+	"fmt"
+	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// eventsKeepAlive is how often a comment is sent to an idle event stream to keep the connection open.
+const eventsKeepAlive = 15 * time.Second
+
+// eventsPollInterval is how often an event stream reads the task status, so a stream of a task
+// processed by another app instance ends once the task is finished.
+const eventsPollInterval = 5 * time.Second
+
 func (h *Handler) setTaskGroup(api *gin.RouterGroup) {
 	taskApiGroup := api.Group("tasks")
 	authMiddleware := middleware.NewAuthMiddleware()
 	taskApiGroup.Use(authMiddleware.BasicAuthMiddleware())
 	{
+		taskApiGroup.GET("/", h.listTasks)
 		taskApiGroup.GET("/:id", h.getTask)
 		taskApiGroup.POST("/", h.createTask)
 		taskApiGroup.DELETE("/:id", h.deleteTask)
 		taskApiGroup.PATCH("/:id", h.addImageToTask)
+		taskApiGroup.POST("/:id/archive", h.addArchiveToTask)
 		taskApiGroup.PATCH("/:id/process", h.processTask)
+		taskApiGroup.POST("/:id/retry", h.retryTask)
+		taskApiGroup.POST("/:id/cancel", h.cancelTask)
+		taskApiGroup.GET("/:id/responses", h.getTaskResponses)
+		taskApiGroup.GET("/:id/images/:name", h.getTaskImage)
+		taskApiGroup.GET("/:id/duplicates", h.getTaskDuplicates)
+		taskApiGroup.GET("/:id/events", h.getTaskEvents)
+		taskApiGroup.POST("/:id/recompute", h.recomputeTask)
 	}
 }
 
@@ -52,11 +75,47 @@ func (h *Handler) getTask(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": task})
 }
 
+func (h *Handler) listTasks(c *gin.Context) {
+
+	filter := &task_model.TaskFilter{}
+	if err := c.ShouldBindQuery(filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.service.ListTasks(filter)
+	if err != nil {
+		if errors.Is(err, tools.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
 func (h *Handler) createTask(c *gin.Context) {
 
-	taskId, err := h.service.CreateTask()
+	// the request body is optional
+	request := &task_model.CreateTaskRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	request.Owner = c.GetString(gin.AuthUserKey)
+
+	taskId, err := h.service.CreateTask(request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, tools.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -80,6 +139,8 @@ func (h *Handler) deleteTask(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, tools.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -93,6 +154,7 @@ func (h *Handler) addImageToTask(c *gin.Context) {
 
 	var taskId int
 	var err error
+	var results []*task_model.UploadResult
 
 	taskIdStr := c.Param("id")
 
@@ -103,22 +165,129 @@ func (h *Handler) addImageToTask(c *gin.Context) {
 		return
 	}
 
-	fileData := &task_model.FileData{}
-	fileData.File, fileData.FileHeader, err = c.Request.FormFile("image")
-	defer fileData.File.Close()
-
+	// files are read part by part straight from the request body
+	limitBody(c, h.uploadMaxBytes)
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to get uploaded image"})
 		return
 	}
 
-	err = h.service.AddImageToTask(taskId, fileData)
+	results, err = h.service.AddImagesToTask(taskId, nextUploadedImage(reader))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Println(err)
+		if errors.Is(err, tools.ErrTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrUnprocessable) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
+
+func (h *Handler) addArchiveToTask(c *gin.Context) {
+
+	var taskId int
+	var err error
+	var results []*task_model.UploadResult
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the archive is read straight from the request body
+	limitBody(c, h.uploadMaxBytes)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to get uploaded archive"})
+		return
+	}
+
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if errors.Is(err, tools.ErrTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to get uploaded archive"})
+			return
+		}
+		if part.FormName() == "archive" && part.FileName() != "" {
+			break
+		}
+		_ = part.Close()
+	}
+
+	results, err = h.service.AddArchiveToTask(taskId, &task_model.FileData{
+		File:        part,
+		FileName:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, tools.ErrTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrUnprocessable) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": "image was successfully added to task"})
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
+
+// nextUploadedImage returns a function taking the next file of the "image" or "images" form fields;
+// other fields are skipped.
+func nextUploadedImage(reader *multipart.Reader) func() (*task_model.FileData, error) {
+	return func() (*task_model.FileData, error) {
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			if errors.Is(err, tools.ErrTooLarge) {
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: malformed multipart form: %v", tools.ErrInvalidInput, err)
+			}
+
+			if part.FileName() == "" || (part.FormName() != "image" && part.FormName() != "images") {
+				_ = part.Close()
+				continue
+			}
+
+			return &task_model.FileData{
+				File:        part,
+				FileName:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+			}, nil
+		}
+	}
 }
 
 func (h *Handler) processTask(c *gin.Context) {
@@ -135,14 +304,308 @@ func (h *Handler) processTask(c *gin.Context) {
 		return
 	}
 
-	err = h.service.UpdateTaskStatus(taskId, "in_progress")
+	err = h.service.EnqueueTask(taskId)
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": "task is being processed"})
+	c.JSON(http.StatusOK, gin.H{"data": "task is queued for processing"})
+}
+
+func (h *Handler) retryTask(c *gin.Context) {
+
+	var taskId int
+	var err error
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.service.RetryTask(taskId)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": "failed images are queued for processing"})
+}
+
+func (h *Handler) cancelTask(c *gin.Context) {
+
+	var taskId int
+	var err error
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.service.CancelTask(taskId)
+	if err != nil {
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": "task was cancelled"})
+}
+
+func (h *Handler) getTaskResponses(c *gin.Context) {
+
+	var taskId int
+	var err error
+	var responses []*task_model.ImageResponse
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	responses, err = h.service.GetTaskResponses(taskId)
+	if err != nil {
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": responses})
+}
+
+// getTaskDuplicates lists clusters of near-duplicate images of the task.
+func (h *Handler) getTaskDuplicates(c *gin.Context) {
+
+	var taskId int
+	var err error
+	var clusters []*task_model.DuplicateCluster
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clusters, err = h.service.GetTaskDuplicates(taskId)
+	if err != nil {
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": clusters})
+}
+
+// getTaskImage sends the image file exactly as uploaded; the ETag is its SHA-256 checksum.
+func (h *Handler) getTaskImage(c *gin.Context) {
+
+	var taskId int
+	var err error
+	var image *task_model.Image
+	var file io.ReadCloser
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	image, file, err = h.service.GetTaskImageFile(taskId, c.Param("name"))
+	if err != nil {
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	defer file.Close()
+
+	headers := map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": image.ImageName}),
+	}
+	if image.Checksum != "" {
+		headers["ETag"] = strconv.Quote(image.Checksum)
+	}
+
+	// images uploaded before sizes were recorded are sent without the length
+	size := image.Size
+	if size == 0 {
+		size = -1
+	}
+
+	c.DataFromReader(http.StatusOK, size, imaging.ContentType(image.Format), file, headers)
+}
+
+// getTaskEvents streams task processing progress as Server-Sent Events. The stream starts with the current
+// task status and ends after the task has reached a final status.
+func (h *Handler) getTaskEvents(c *gin.Context) {
+
+	var taskId int
+	var err error
+	var task *task_model.Task
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// subscribe before reading the task, so no status change is missed
+	events, unsubscribe := h.service.Subscribe(taskId)
+	defer unsubscribe()
+
+	task, err = h.service.GetTaskStatus(taskId)
+	if err != nil {
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent(event_model.TypeStatus, event_model.NewEvent(event_model.TypeStatus, taskId, event_model.Status{
+		Status: task.Status,
+		Reason: task.StatusReason,
+	}))
+
+	if event_model.IsFinalStatus(task.Status) {
+		c.SSEvent(event_model.TypeStatistics, event_model.NewEvent(event_model.TypeStatistics, taskId, task.Statistics))
+		c.Writer.Flush()
+		return
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	// events are published only by the app instance processing the task,
+	// the task status is polled to learn about changes made elsewhere
+	poll := time.NewTicker(eventsPollInterval)
+	defer poll.Stop()
+
+	lastStatus := task.Status
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-poll.C:
+			task, err := h.service.GetTaskStatus(taskId)
+			if errors.Is(err, tools.ErrNotFound) {
+				return false
+			}
+			if err != nil {
+				log.Printf("error polling task %d status: %v\n", taskId, err)
+				return true
+			}
+
+			if task.Status == lastStatus {
+				return true
+			}
+			lastStatus = task.Status
+
+			if event_model.IsFinalStatus(task.Status) {
+				c.SSEvent(event_model.TypeStatistics, event_model.NewEvent(event_model.TypeStatistics, taskId, task.Statistics))
+			}
+
+			c.SSEvent(event_model.TypeStatus, event_model.NewEvent(event_model.TypeStatus, taskId, event_model.Status{
+				Status: task.Status,
+				Reason: task.StatusReason,
+			}))
+
+			return !event_model.IsFinalStatus(task.Status)
+		case event, ok := <-events:
+			// the subscriber did not keep up and was dropped, the client reconnects and gets the current status
+			if !ok {
+				return false
+			}
+
+			c.SSEvent(event.Type, event)
+
+			status, isStatus := event.Data.(event_model.Status)
+			if isStatus {
+				lastStatus = status.Status
+			}
+
+			return !isStatus || !event_model.IsFinalStatus(status.Status)
+		}
+	})
+}
+
+func (h *Handler) recomputeTask(c *gin.Context) {
+
+	var taskId int
+	var err error
+
+	taskIdStr := c.Param("id")
+
+	taskId, err = strconv.Atoi(taskIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.service.RecomputeTask(taskId)
+	if err != nil {
+		if errors.Is(err, tools.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, tools.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
 
-	h.service.ProcessTask(taskId)
+	c.JSON(http.StatusOK, gin.H{"data": "task was successfully recomputed"})
 }
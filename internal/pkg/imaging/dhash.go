@@ -0,0 +1,119 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// dhashSamples bounds the number of pixels sampled along a side of a cell, so large images are hashed quickly.
+const dhashSamples = 8
+
+// DHash returns the 64-bit difference hash of the image: the image is shrunk to 9x8 gray cells
+// and each bit tells whether a cell is brighter than its right neighbour.
+// Hashes of near-duplicate images differ in a few bits, see Distance.
+func DHash(img image.Image) uint64 {
+	const width, height = 9, 8
+
+	var gray [height][width]float64
+	bounds := img.Bounds()
+
+	for cy := 0; cy < height; cy++ {
+		y0, y1 := cellSpan(bounds.Min.Y, bounds.Dy(), cy, height)
+
+		for cx := 0; cx < width; cx++ {
+			x0, x1 := cellSpan(bounds.Min.X, bounds.Dx(), cx, width)
+
+			var sum float64
+			var n int
+
+			for y := y0; y < y1; y += max((y1-y0)/dhashSamples, 1) {
+				for x := x0; x < x1; x += max((x1-x0)/dhashSamples, 1) {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					n++
+				}
+			}
+
+			gray[cy][cx] = sum / float64(n)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// cellSpan returns the pixel range of the i-th of n cells along a side of the given size;
+// the range is never empty, cells of images smaller than the grid overlap.
+func cellSpan(start, size, i, n int) (from, to int) {
+	from = start + i*size/n
+	to = max(start+(i+1)*size/n, from+1)
+
+	return from, to
+}
+
+// Distance returns the number of bits two hashes differ in.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Clusters groups indexes of the hashes whose distance is at most maxDistance.
+// Groups are linked transitively, so a burst of gradually changing shots forms a single group.
+// Only groups of two or more indexes are returned, indexes of a group are ascending
+// and groups are ordered by their first index.
+func Clusters(hashes []uint64, maxDistance int) [][]int {
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if Distance(hashes[i], hashes[j]) > maxDistance {
+				continue
+			}
+
+			// the smaller index is the root, so it comes first in its group
+			ri, rj := find(i), find(j)
+			if ri != rj {
+				parent[max(ri, rj)] = min(ri, rj)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+
+	for i := range hashes {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters [][]int
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+
+	return clusters
+}
@@ -0,0 +1,75 @@
+package imaging_test
+
+import (
+	"face-track/internal/pkg/imaging"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// gradient returns an image brightening from left to right, shifted by the offset.
+func gradient(width, height, offset int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			v := uint8(min((x*255/width+y)+offset, 255))
+			img.Set(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+func Test_DHash(t *testing.T) {
+
+	original := gradient(300, 200, 0)
+
+	// a slightly brighter copy of another size is a near-duplicate
+	if d := imaging.Distance(imaging.DHash(original), imaging.DHash(gradient(150, 100, 10))); d > 4 {
+		t.Errorf("imaging.Distance() of near-duplicates = %d, want at most 4", d)
+	}
+
+	// the mirrored image is not
+	if d := imaging.Distance(imaging.DHash(original), imaging.DHash(imaging.Orient(original, 2))); d < 32 {
+		t.Errorf("imaging.Distance() of different images = %d, want at least 32", d)
+	}
+
+	// images smaller than the grid are hashed too
+	_ = imaging.DHash(gradient(2, 1, 0))
+}
+
+func Test_Clusters(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		hashes      []uint64
+		maxDistance int
+		want        [][]int
+	}{
+		{
+			name:        "no duplicates",
+			hashes:      []uint64{0x0, 0xff, 0xff00},
+			maxDistance: 2,
+		},
+		{
+			name:        "duplicates linked transitively",
+			hashes:      []uint64{0x0, 0xffff0000, 0x3, 0xffff0001, 0xf},
+			maxDistance: 2,
+			want:        [][]int{{0, 2, 4}, {1, 3}},
+		},
+		{
+			name:        "exact duplicates",
+			hashes:      []uint64{0xab, 0xab},
+			maxDistance: 0,
+			want:        [][]int{{0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imaging.Clusters(tt.hashes, tt.maxDistance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("imaging.Clusters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
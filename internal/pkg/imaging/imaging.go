@@ -0,0 +1,184 @@
+// Package imaging detects formats of uploaded images by their content, decodes them
+// and prepares the JPEG rendition sent to the face detector.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// Supported image formats.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatTIFF = "tiff"
+	FormatWebP = "webp"
+)
+
+// renditionQuality is the JPEG quality of renditions sent to the detector.
+const renditionQuality = 90
+
+// ErrUnsupportedFormat is returned decoding data which is not an image of a supported format.
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// signature identifies a format by the leading bytes of the file; '?' matches any byte.
+type signature struct {
+	format string
+	magic  string
+}
+
+var signatures = []signature{
+	{format: FormatJPEG, magic: "\xff\xd8\xff"},
+	{format: FormatPNG, magic: "\x89PNG\r\n\x1a\n"},
+	{format: FormatGIF, magic: "GIF87a"},
+	{format: FormatGIF, magic: "GIF89a"},
+	{format: FormatBMP, magic: "BM"},
+	{format: FormatTIFF, magic: "II*\x00"},
+	{format: FormatTIFF, magic: "MM\x00*"},
+	{format: FormatWebP, magic: "RIFF????WEBPVP8"},
+}
+
+// decoders decode images of the supported formats.
+var decoders = map[string]func(io.Reader) (image.Image, error){
+	FormatJPEG: jpeg.Decode,
+	FormatPNG:  png.Decode,
+	FormatGIF:  gif.Decode,
+	FormatBMP:  bmp.Decode,
+	FormatTIFF: tiff.Decode,
+	FormatWebP: webp.Decode,
+}
+
+// configDecoders read dimensions of images of the supported formats without decoding the pixels.
+var configDecoders = map[string]func(io.Reader) (image.Config, error){
+	FormatJPEG: jpeg.DecodeConfig,
+	FormatPNG:  png.DecodeConfig,
+	FormatGIF:  gif.DecodeConfig,
+	FormatBMP:  bmp.DecodeConfig,
+	FormatTIFF: tiff.DecodeConfig,
+	FormatWebP: webp.DecodeConfig,
+}
+
+// extensions are file extensions of the supported formats.
+var extensions = map[string]string{
+	FormatJPEG: ".jpg",
+	FormatPNG:  ".png",
+	FormatGIF:  ".gif",
+	FormatBMP:  ".bmp",
+	FormatTIFF: ".tiff",
+	FormatWebP: ".webp",
+}
+
+// contentTypes are MIME types of the supported formats.
+var contentTypes = map[string]string{
+	FormatJPEG: "image/jpeg",
+	FormatPNG:  "image/png",
+	FormatGIF:  "image/gif",
+	FormatBMP:  "image/bmp",
+	FormatTIFF: "image/tiff",
+	FormatWebP: "image/webp",
+}
+
+// Sniff detects the image format by the leading bytes of the file; the client supplied
+// name and content type are not trusted.
+func Sniff(data []byte) (format string, ok bool) {
+	for _, sig := range signatures {
+		if matchMagic(data, sig.magic) {
+			return sig.format, true
+		}
+	}
+
+	return "", false
+}
+
+// matchMagic reports whether data starts with the magic.
+func matchMagic(data []byte, magic string) bool {
+	if len(data) < len(magic) {
+		return false
+	}
+
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != data[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Extension returns the file extension of the format.
+func Extension(format string) string {
+	return extensions[format]
+}
+
+// ContentType returns the MIME type of the format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Decode detects the format of the image data and decodes it;
+// returns ErrUnsupportedFormat if the data is not a supported image.
+func Decode(data []byte) (img image.Image, format string, err error) {
+
+	format, ok := Sniff(data)
+	if !ok {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	img, err = decoders[format](bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, format, nil
+}
+
+// DecodeConfig detects the format of the image data and reads the image dimensions from its header,
+// so they can be checked before the pixels are allocated; returns ErrUnsupportedFormat
+// if the data is not a supported image.
+func DecodeConfig(data []byte) (config image.Config, format string, err error) {
+
+	format, ok := Sniff(data)
+	if !ok {
+		return image.Config{}, "", ErrUnsupportedFormat
+	}
+
+	config, err = configDecoders[format](bytes.NewReader(data))
+	if err != nil {
+		return image.Config{}, "", err
+	}
+
+	return config, format, nil
+}
+
+// Flatten returns the image composed over a white background, as JPEG has no transparency
+// and transparent pixels would turn black.
+func Flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+
+	return flat
+}
+
+// EncodeJPEG writes the image as JPEG rendition for the detector.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, Flatten(img), &jpeg.Options{Quality: renditionQuality})
+}
@@ -0,0 +1,180 @@
+package imaging_test
+
+import (
+	"bytes"
+	"errors"
+	"face-track/internal/pkg/imaging"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 3; y++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, encode func(*bytes.Buffer) error) []byte {
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_Decode(t *testing.T) {
+
+	img := testImage()
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantFormat string
+		wantErr    error
+	}{
+		{
+			name:       "jpeg",
+			data:       encode(t, func(b *bytes.Buffer) error { return jpeg.Encode(b, img, nil) }),
+			wantFormat: imaging.FormatJPEG,
+		},
+		{
+			name:       "png",
+			data:       encode(t, func(b *bytes.Buffer) error { return png.Encode(b, img) }),
+			wantFormat: imaging.FormatPNG,
+		},
+		{
+			name:       "gif",
+			data:       encode(t, func(b *bytes.Buffer) error { return gif.Encode(b, img, nil) }),
+			wantFormat: imaging.FormatGIF,
+		},
+		{
+			name:       "bmp",
+			data:       encode(t, func(b *bytes.Buffer) error { return bmp.Encode(b, img) }),
+			wantFormat: imaging.FormatBMP,
+		},
+		{
+			name:       "tiff",
+			data:       encode(t, func(b *bytes.Buffer) error { return tiff.Encode(b, img, nil) }),
+			wantFormat: imaging.FormatTIFF,
+		},
+		{
+			name:    "not an image",
+			data:    []byte("<html></html>"),
+			wantErr: imaging.ErrUnsupportedFormat,
+		},
+		{
+			name:    "truncated png",
+			data:    []byte("\x89PNG\r\n\x1a\n"),
+			wantErr: errors.New("any"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, format, err := imaging.Decode(tt.data)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("imaging.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(tt.wantErr, imaging.ErrUnsupportedFormat) && !errors.Is(err, imaging.ErrUnsupportedFormat) {
+				t.Errorf("imaging.Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if format != tt.wantFormat {
+				t.Errorf("imaging.Decode() format = %v, want %v", format, tt.wantFormat)
+			}
+
+			if got.Bounds() != img.Bounds() {
+				t.Errorf("imaging.Decode() bounds = %v, want %v", got.Bounds(), img.Bounds())
+			}
+
+			// dimensions are read without decoding the pixels
+			config, format, err := imaging.DecodeConfig(tt.data)
+			if err != nil {
+				t.Fatalf("imaging.DecodeConfig() error = %v", err)
+			}
+			if format != tt.wantFormat || config.Width != img.Bounds().Dx() || config.Height != img.Bounds().Dy() {
+				t.Errorf("imaging.DecodeConfig() = %vx%v %v, want %vx%v %v",
+					config.Width, config.Height, format, img.Bounds().Dx(), img.Bounds().Dy(), tt.wantFormat)
+			}
+		})
+	}
+}
+
+func Test_Sniff(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantFormat string
+		wantOk     bool
+	}{
+		{
+			name:       "webp",
+			data:       []byte("RIFF\x24\x00\x00\x00WEBPVP8 "),
+			wantFormat: imaging.FormatWebP,
+			wantOk:     true,
+		},
+		{
+			name:   "riff which is not webp",
+			data:   []byte("RIFF\x24\x00\x00\x00WAVEfmt "),
+			wantOk: false,
+		},
+		{
+			name:       "big-endian tiff",
+			data:       []byte("MM\x00*\x00\x00\x00\x08"),
+			wantFormat: imaging.FormatTIFF,
+			wantOk:     true,
+		},
+		{
+			name:   "empty",
+			data:   nil,
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			format, ok := imaging.Sniff(tt.data)
+			if format != tt.wantFormat || ok != tt.wantOk {
+				t.Errorf("imaging.Sniff() = %v, %v, want %v, %v", format, ok, tt.wantFormat, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_Flatten(t *testing.T) {
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(1, 0, color.NRGBA{R: 255, A: 255})
+
+	flat := imaging.Flatten(img)
+
+	if r, g, b, _ := flat.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("imaging.Flatten() transparent pixel = %v, want white", flat.At(0, 0))
+	}
+
+	if r, g, b, _ := flat.At(1, 0).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("imaging.Flatten() opaque pixel = %v, want red", flat.At(1, 0))
+	}
+
+	opaque := testImage()
+	if imaging.Flatten(opaque) != image.Image(opaque) {
+		t.Errorf("imaging.Flatten() copied an opaque image")
+	}
+}
@@ -0,0 +1,219 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// orientationTag is the EXIF tag of the image orientation.
+const orientationTag = 0x0112
+
+// Orientation returns the EXIF orientation (1-8) of the image data in the format;
+// 1, i.e. upright, if the image has no orientation or it can not be read.
+func Orientation(data []byte, format string) int {
+	var exif []byte
+
+	switch format {
+	case FormatJPEG:
+		exif = jpegExif(data)
+	case FormatTIFF:
+		exif = data
+	case FormatPNG:
+		exif = pngExif(data)
+	case FormatWebP:
+		exif = webpExif(data)
+	}
+
+	orientation := tiffOrientation(exif)
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+
+	return orientation
+}
+
+// jpegExif returns the EXIF data of the JPEG APP1 segment.
+func jpegExif(data []byte) []byte {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+
+		marker := data[i+1]
+		if marker == 0xd8 || (marker >= 0xd0 && marker <= 0xd7) || marker == 0xff {
+			// markers without a payload
+			i++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// image data starts, metadata is over
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+
+		payload := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return payload[6:]
+		}
+
+		i += 2 + length
+	}
+
+	return nil
+}
+
+// pngExif returns the data of the PNG eXIf chunk.
+func pngExif(data []byte) []byte {
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		if length < 0 || i+8+length > len(data) {
+			return nil
+		}
+
+		switch chunkType {
+		case "eXIf":
+			return data[i+8 : i+8+length]
+		case "IDAT", "IEND":
+			return nil
+		}
+
+		// chunk data is followed by the CRC
+		i += 12 + length
+	}
+
+	return nil
+}
+
+// webpExif returns the data of the WebP EXIF chunk.
+func webpExif(data []byte) []byte {
+	for i := 12; i+8 <= len(data); {
+		fourCC := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if length < 0 || i+8+length > len(data) {
+			return nil
+		}
+
+		if fourCC == "EXIF" {
+			return bytes.TrimPrefix(data[i+8:i+8+length], []byte("Exif\x00\x00"))
+		}
+
+		// chunks are padded to an even size
+		i += 8 + length + length%2
+	}
+
+	return nil
+}
+
+// tiffOrientation reads the orientation tag of the first IFD of TIFF structured data; returns 0 if there is none.
+func tiffOrientation(data []byte) int {
+	if len(data) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(data[4:]))
+	if offset < 8 || offset+2 > len(data) {
+		return 0
+	}
+
+	entries := int(order.Uint16(data[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(data) {
+			return 0
+		}
+
+		// the SHORT value is stored in the first bytes of the value field
+		if order.Uint16(data[entry:]) == orientationTag && order.Uint16(data[entry+2:]) == 3 {
+			return int(order.Uint16(data[entry+8:]))
+		}
+	}
+
+	return 0
+}
+
+// Orient transforms the image of the EXIF orientation to the upright one.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// orientations from 5 on swap the sides
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				sx, sy = y, x
+			case 6: // needs rotating 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored along the top-right diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs rotating 90 counterclockwise
+				sx, sy = w-1-y, x
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
+
+// UnrotateRect maps the rectangle found on the image rotated clockwise by the rotation in degrees
+// back to the image of the size before the rotation.
+func UnrotateRect(rect image.Rectangle, rotation int, size image.Point) image.Rectangle {
+	return image.Rectangle{
+		Min: UnrotatePoint(rect.Min, rotation, size),
+		Max: UnrotatePoint(rect.Max, rotation, size),
+	}.Canon()
+}
+
+// UnrotatePoint maps the point on the image rotated clockwise by the rotation in degrees
+// back to the image of the size before the rotation. Rotations are multiples of 90 degrees.
+func UnrotatePoint(point image.Point, rotation int, size image.Point) image.Point {
+	switch ((rotation % 360) + 360) % 360 {
+	case 90:
+		return image.Point{X: point.Y, Y: size.Y - point.X}
+	case 180:
+		return image.Point{X: size.X - point.X, Y: size.Y - point.Y}
+	case 270:
+		return image.Point{X: size.X - point.Y, Y: point.X}
+	default:
+		return point
+	}
+}
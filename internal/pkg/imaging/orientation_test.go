@@ -0,0 +1,182 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"face-track/internal/pkg/imaging"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifOrientation returns little-endian TIFF structured EXIF data with the orientation tag.
+func exifOrientation(orientation uint16) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("II*\x00")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(8))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1))
+
+	// tag, SHORT type, count, value
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{0x0112, 3})
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(1))
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{orientation, 0})
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(0))
+
+	return buf.Bytes()
+}
+
+// jpegWithExif inserts an APP1 segment with the EXIF data after the SOI marker of the JPEG.
+func jpegWithExif(t *testing.T, exif []byte) []byte {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := append([]byte("Exif\x00\x00"), exif...)
+
+	var buf bytes.Buffer
+	buf.Write(img.Bytes()[:2])
+	buf.Write([]byte{0xff, 0xe1})
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(payload)+2))
+	buf.Write(payload)
+	buf.Write(img.Bytes()[2:])
+
+	return buf.Bytes()
+}
+
+func Test_Orientation(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   int
+	}{
+		{
+			name:   "jpeg rotated",
+			data:   jpegWithExif(t, exifOrientation(6)),
+			format: imaging.FormatJPEG,
+			want:   6,
+		},
+		{
+			name:   "jpeg without exif",
+			data:   encode(t, func(b *bytes.Buffer) error { return jpeg.Encode(b, testImage(), nil) }),
+			format: imaging.FormatJPEG,
+			want:   1,
+		},
+		{
+			name:   "tiff mirrored",
+			data:   exifOrientation(2),
+			format: imaging.FormatTIFF,
+			want:   2,
+		},
+		{
+			name:   "invalid orientation",
+			data:   jpegWithExif(t, exifOrientation(9)),
+			format: imaging.FormatJPEG,
+			want:   1,
+		},
+		{
+			name:   "truncated exif",
+			data:   jpegWithExif(t, exifOrientation(6)[:12]),
+			format: imaging.FormatJPEG,
+			want:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imaging.Orientation(tt.data, tt.format); got != tt.want {
+				t.Errorf("imaging.Orientation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Orient(t *testing.T) {
+
+	// 2x1 image: red on the left, blue on the right
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	tests := []struct {
+		name        string
+		orientation int
+		wantSize    image.Point
+		wantRed     image.Point
+	}{
+		{name: "upright", orientation: 1, wantSize: image.Pt(2, 1), wantRed: image.Pt(0, 0)},
+		{name: "mirrored", orientation: 2, wantSize: image.Pt(2, 1), wantRed: image.Pt(1, 0)},
+		{name: "rotated 180", orientation: 3, wantSize: image.Pt(2, 1), wantRed: image.Pt(1, 0)},
+		{name: "rotate clockwise", orientation: 6, wantSize: image.Pt(1, 2), wantRed: image.Pt(0, 0)},
+		{name: "rotate counterclockwise", orientation: 8, wantSize: image.Pt(1, 2), wantRed: image.Pt(0, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got := imaging.Orient(img, tt.orientation)
+
+			if got.Bounds().Size() != tt.wantSize {
+				t.Errorf("imaging.Orient() size = %v, want %v", got.Bounds().Size(), tt.wantSize)
+			}
+
+			if got.At(tt.wantRed.X, tt.wantRed.Y) != color.Color(red) {
+				t.Errorf("imaging.Orient() red pixel is not at %v", tt.wantRed)
+			}
+		})
+	}
+}
+
+func Test_UnrotateRect(t *testing.T) {
+
+	// a 100x50 image; the box found on the rotated image is mapped back
+	size := image.Pt(100, 50)
+	box := image.Rect(10, 20, 30, 40)
+
+	tests := []struct {
+		name     string
+		rect     image.Rectangle
+		rotation int
+		want     image.Rectangle
+	}{
+		{
+			name:     "not rotated",
+			rect:     box,
+			rotation: 0,
+			want:     box,
+		},
+		{
+			name:     "rotated clockwise",
+			rect:     image.Rect(50-40, 10, 50-20, 30),
+			rotation: 90,
+			want:     box,
+		},
+		{
+			name:     "rotated 180",
+			rect:     image.Rect(100-30, 50-40, 100-10, 50-20),
+			rotation: 180,
+			want:     box,
+		},
+		{
+			name:     "rotated counterclockwise",
+			rect:     image.Rect(20, 100-30, 40, 100-10),
+			rotation: -90,
+			want:     box,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imaging.UnrotateRect(tt.rect, tt.rotation, size); got != tt.want {
+				t.Errorf("imaging.UnrotateRect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
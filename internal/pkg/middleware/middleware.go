@@ -34,6 +34,7 @@ func NewAuthMiddleware() *AuthMiddleware {
 }
 
 // BasicAuthMiddleware returns a Gin middleware that enforces basic authentication.
+// The authenticated user is stored in the context under gin.AuthUserKey.
 func (m *AuthMiddleware) BasicAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, pass, ok := c.Request.BasicAuth()
@@ -42,6 +43,7 @@ func (m *AuthMiddleware) BasicAuthMiddleware() gin.HandlerFunc {
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
+		c.Set(gin.AuthUserKey, user)
 		c.Next()
 	}
 }
@@ -0,0 +1,64 @@
+// Package detector_model provides provider independent models of face detection results.
+package detector_model
+
+// DetectResult holds the normalized result of a face detection request.
+type DetectResult struct {
+	Faces    []*Face
+	Rotation int
+	// Raw is the response as returned by the provider, kept for audit and re-analysis.
+	Raw []byte `json:"-"`
+}
+
+// Face represents a detected face regardless of the detection provider.
+// Fields a provider does not support are left zero.
+type Face struct {
+	Gender      string
+	Age         float64
+	AgeVariance float64
+	Ethnicity   string
+	Bbox        Bbox
+	Score       float64
+	Liveness    int
+	Attributes  Attributes
+	Landmarks   []Landmark
+	Masks       Masks
+	Quality     Quality
+}
+
+// Bbox represents the bounding box of a detected face.
+type Bbox struct {
+	Height int
+	Width  int
+	X      int
+	Y      int
+}
+
+// Attributes represents facial features.
+type Attributes struct {
+	FacialHair string
+	Glasses    string
+	HairColor  string
+	HairType   string
+	Headwear   string
+}
+
+// Landmark represents a facial landmark coordinate.
+type Landmark struct {
+	X int
+	Y int
+}
+
+// Masks contains face mask detection scores.
+type Masks struct {
+	FullFace  int
+	LowerFace int
+	None      int
+	Other     int
+}
+
+// Quality represents image quality metrics of the face.
+type Quality struct {
+	Blurriness    int
+	Overexposure  int
+	Underexposure int
+}
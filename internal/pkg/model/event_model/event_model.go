@@ -0,0 +1,58 @@
+// Package event_model defines data structures for task progress events.
+package event_model
+
+const (
+	// TypeImageProcessed is published when detection of an image has finished or failed.
+	TypeImageProcessed = "image_processed"
+
+	// TypeFacesFound is published when faces were found on an image.
+	TypeFacesFound = "faces_found"
+
+	// TypeStatus is published when the task status changes.
+	TypeStatus = "status"
+
+	// TypeStatistics is published with the final task statistics, its data is task_model.Statistics.
+	TypeStatistics = "statistics"
+)
+
+// Event represents a change in task processing.
+type Event struct {
+	Type   string      `json:"-"`
+	TaskId int         `json:"-"`
+	Data   interface{} `json:"data"`
+}
+
+// ImageProcessed is the data of the TypeImageProcessed event.
+// Cached is set when the detection result of an image of the same content was reused.
+type ImageProcessed struct {
+	ImageName string `json:"name"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Cached    bool   `json:"cached,omitempty"`
+}
+
+// FacesFound is the data of the TypeFacesFound event.
+type FacesFound struct {
+	ImageName string `json:"name"`
+	Faces     int    `json:"faces"`
+}
+
+// Status is the data of the TypeStatus event.
+type Status struct {
+	Status string `json:"taskStatus"`
+	Reason string `json:"statusReason,omitempty"`
+}
+
+// NewEvent returns an event of the given type for the task.
+func NewEvent(eventType string, taskId int, data interface{}) *Event {
+	return &Event{
+		Type:   eventType,
+		TaskId: taskId,
+		Data:   data,
+	}
+}
+
+// IsFinalStatus reports whether the task status ends processing.
+func IsFinalStatus(status string) bool {
+	return status != "new" && status != "in_progress"
+}
@@ -0,0 +1,17 @@
+// Package job_model defines data structures for the background job queue.
+package job_model
+
+const (
+	// KindProcessTask is a job processing task images.
+	KindProcessTask = "process_task"
+)
+
+// Job represents a queued unit of background work related to a task.
+type Job struct {
+	Id        int    `db:"id"`
+	TaskId    int    `db:"task_id"`
+	Kind      string `db:"kind"`
+	Status    string `db:"job_status"`
+	Attempts  int    `db:"attempts"`
+	LastError string `db:"last_error"`
+}
@@ -2,8 +2,14 @@
 package task_model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"face-track/internal/pkg/model/face_cloud_model"
-	"mime/multipart"
+	"face-track/tools"
+	"fmt"
+	"io"
+	"time"
 )
 
 // Models for working with API and database
@@ -14,17 +20,89 @@ type TaskIdRequest struct {
 	TaskId int `json:"id"`
 }
 
+// TaskFilter represents a request listing tasks: filters, sorting and the page.
+// Zero values leave the filters unset.
+type TaskFilter struct {
+	Statuses    []string  `form:"status"`
+	CreatedFrom time.Time `form:"createdFrom" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   time.Time `form:"createdTo" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedFrom time.Time `form:"updatedFrom" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedTo   time.Time `form:"updatedTo" time_format:"2006-01-02T15:04:05Z07:00"`
+	FacesMin    *int      `form:"facesMin"`
+	FacesMax    *int      `form:"facesMax"`
+	Sort        string    `form:"sort"`
+	Order       string    `form:"order"`
+	Limit       int       `form:"limit"`
+	Cursor      string    `form:"cursor"`
+
+	// After is the decoded cursor: the page starts after this task.
+	After *TaskCursor `form:"-"`
+}
+
+// TaskCursor is the position of a task in the sorted list: the sort field, its value and the task ID.
+type TaskCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
+
+// TaskList represents a page of tasks; NextCursor is empty on the last page.
+type TaskList struct {
+	Tasks      []*TaskListItem `json:"tasks"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// CreateTaskRequest represents an optional request body of task creation.
+// ExcludeDuplicates leaves near-duplicate images but one of each cluster out of the statistics.
+// Owner is the authenticated user creating the task, whose storage quota the task images count against.
+type CreateTaskRequest struct {
+	CallbackUrl       string `json:"callbackUrl"`
+	ExcludeDuplicates bool   `json:"excludeDuplicates"`
+	Owner             string `json:"-"`
+}
+
 // Task represents a task with its status, images, and statistics.
 type Task struct {
-	Id           int        `db:"id" json:"id"`
-	Status       string     `db:"task_status" json:"taskStatus"`
-	Images       []*Image   `json:"images"`
-	FacesTotal   int        `db:"faces_total" json:"-"`
-	FacesMale    int        `db:"faces_male" json:"-"`
-	FacesFemale  int        `db:"faces_female" json:"-"`
-	AgeFemaleAvg int        `db:"age_female_avg" json:"-"`
-	AgeMaleAvg   int        `db:"age_male_avg" json:"-"`
-	Statistics   Statistics `json:"statistics"`
+	Id                int        `db:"id" json:"id"`
+	Status            string     `db:"task_status" json:"taskStatus"`
+	StatusReason      string     `db:"status_reason" json:"statusReason,omitempty"`
+	CallbackUrl       string     `db:"callback_url" json:"callbackUrl,omitempty"`
+	ExcludeDuplicates bool       `db:"exclude_duplicates" json:"excludeDuplicates"`
+	CreatedAt         time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt         time.Time  `db:"updated_at" json:"updatedAt"`
+	Images            []*Image   `json:"images"`
+	FacesTotal        int        `db:"faces_total" json:"-"`
+	FacesMale         int        `db:"faces_male" json:"-"`
+	FacesFemale       int        `db:"faces_female" json:"-"`
+	AgeFemaleAvg      int        `db:"age_female_avg" json:"-"`
+	AgeMaleAvg        int        `db:"age_male_avg" json:"-"`
+	Statistics        Statistics `json:"statistics"`
+}
+
+// TaskListItem represents a task in a task list; its images are returned with the task only.
+type TaskListItem struct {
+	Id                int        `json:"id"`
+	Status            string     `json:"taskStatus"`
+	StatusReason      string     `json:"statusReason,omitempty"`
+	CallbackUrl       string     `json:"callbackUrl,omitempty"`
+	ExcludeDuplicates bool       `json:"excludeDuplicates"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+	Statistics        Statistics `json:"statistics"`
+}
+
+// NewTaskListItem returns the list item of the task.
+func NewTaskListItem(task *Task) *TaskListItem {
+	return &TaskListItem{
+		Id:                task.Id,
+		Status:            task.Status,
+		StatusReason:      task.StatusReason,
+		CallbackUrl:       task.CallbackUrl,
+		ExcludeDuplicates: task.ExcludeDuplicates,
+		CreatedAt:         task.CreatedAt,
+		UpdatedAt:         task.UpdatedAt,
+		Statistics:        task.Statistics,
+	}
 }
 
 // Statistics holds aggregated face detection data.
@@ -37,29 +115,209 @@ type Statistics struct {
 }
 
 // Image represents an image linked to a task.
+// Status is "pending" until detection succeeds ("done") or fails ("failed" with the error).
+// ImageName is the name of the uploaded file, stored verbatim under OriginalKey; Checksum is its SHA-256.
+// RenditionKey is the JPEG file sent to the detector, the same file for upright JPEG uploads.
+// Images of the same content share the files.
+// The rendition is turned upright according to the EXIF Orientation; Width and Height are its size,
+// face bounding boxes are reported in its coordinates. DHash is the hex perceptual hash of the upright image,
+// empty for images uploaded before it was computed.
 type Image struct {
-	Id        int     `db:"id" json:"-"`
-	TaskId    int     `db:"task_id" json:"-"`
-	ImageName string  `db:"image_name" json:"name"`
-	DoneFlag  bool    `db:"done" json:"-"`
-	Faces     []*Face `json:"faces"`
+	Id           int     `db:"id" json:"-"`
+	TaskId       int     `db:"task_id" json:"-"`
+	ImageName    string  `db:"image_name" json:"name"`
+	OriginalKey  string  `db:"original_key" json:"-"`
+	RenditionKey string  `db:"rendition_key" json:"-"`
+	Format       string  `db:"image_format" json:"format"`
+	Checksum     string  `db:"checksum" json:"checksum,omitempty"`
+	Size         int64   `db:"size_bytes" json:"size,omitempty"`
+	Orientation  int     `db:"orientation" json:"orientation"`
+	Width        int     `db:"width" json:"width,omitempty"`
+	Height       int     `db:"height" json:"height,omitempty"`
+	DHash        string  `db:"dhash" json:"dhash,omitempty"`
+	Status       string  `db:"image_status" json:"status"`
+	Error        string  `db:"error" json:"error,omitempty"`
+	Attempts     int     `db:"attempts" json:"attempts"`
+	Faces        []*Face `json:"faces"`
 }
 
 // Face represents detected facial attributes within an image.
 type Face struct {
-	Id      int                   `db:"id" json:"-"`
-	ImageId int                   `db:"image_id" json:"-"`
-	Gender  string                `db:"gender" json:"gender"`
-	Age     int                   `db:"age" json:"age"`
-	Height  int                   `db:"bbox_height" json:"-"`
-	Width   int                   `db:"bbox_width" json:"-"`
-	X       int                   `db:"bbox_x" json:"-"`
-	Y       int                   `db:"bbox_y" json:"-"`
-	Bbox    face_cloud_model.Bbox `json:"bbox"`
-}
-
-// FileData represents a file uploaded via multipart form.
+	Id            int                         `db:"id" json:"-"`
+	ImageId       int                         `db:"image_id" json:"-"`
+	Gender        string                      `db:"gender" json:"gender"`
+	Age           int                         `db:"age" json:"age"`
+	AgeVariance   float64                     `db:"age_variance" json:"ageVariance"`
+	Ethnicity     string                      `db:"ethnicity" json:"ethnicity"`
+	Height        int                         `db:"bbox_height" json:"-"`
+	Width         int                         `db:"bbox_width" json:"-"`
+	X             int                         `db:"bbox_x" json:"-"`
+	Y             int                         `db:"bbox_y" json:"-"`
+	Bbox          face_cloud_model.Bbox       `json:"bbox"`
+	Score         float64                     `db:"score" json:"score"`
+	Liveness      int                         `db:"liveness" json:"liveness"`
+	FacialHair    string                      `db:"facial_hair" json:"-"`
+	Glasses       string                      `db:"glasses" json:"-"`
+	HairColor     string                      `db:"hair_color" json:"-"`
+	HairType      string                      `db:"hair_type" json:"-"`
+	Headwear      string                      `db:"headwear" json:"-"`
+	Attributes    face_cloud_model.Attributes `json:"attributes"`
+	Landmarks     Landmarks                   `db:"landmarks" json:"landmarks"`
+	MaskFullFace  int                         `db:"mask_full_face" json:"-"`
+	MaskLowerFace int                         `db:"mask_lower_face" json:"-"`
+	MaskNone      int                         `db:"mask_none" json:"-"`
+	MaskOther     int                         `db:"mask_other" json:"-"`
+	Masks         face_cloud_model.Masks      `json:"masks"`
+	Blurriness    int                         `db:"quality_blurriness" json:"-"`
+	Overexposure  int                         `db:"quality_overexposure" json:"-"`
+	Underexposure int                         `db:"quality_underexposure" json:"-"`
+	Quality       face_cloud_model.Quality    `json:"quality"`
+}
+
+// Landmarks is a list of facial landmarks stored as JSON in the database.
+type Landmarks []face_cloud_model.Landmark
+
+// Value implements driver.Valuer; the JSON is passed as text, so it is not sent as bytea.
+func (l Landmarks) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (l *Landmarks) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	case nil:
+		*l = nil
+		return nil
+	default:
+		return errors.New("unsupported landmarks type")
+	}
+}
+
+// ImageResponse holds the raw detection provider response for an image.
+type ImageResponse struct {
+	Id        int       `db:"id" json:"-"`
+	ImageId   int       `db:"image_id" json:"-"`
+	ImageName string    `db:"image_name" json:"imageName"`
+	Provider  string    `db:"provider" json:"provider"`
+	Rotation  int       `db:"rotation" json:"rotation"`
+	Response  RawJSON   `db:"response" json:"response"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// RawJSON is a JSON document stored in the database as is.
+type RawJSON []byte
+
+// MarshalJSON implements json.Marshaler.
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// Value implements driver.Valuer; the JSON is passed as text, so it is not sent as bytea.
+func (j RawJSON) Value() (driver.Value, error) {
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner.
+func (j *RawJSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		*j = append(RawJSON(nil), v...)
+		return nil
+	case string:
+		*j = RawJSON(v)
+		return nil
+	case nil:
+		*j = nil
+		return nil
+	default:
+		return errors.New("unsupported json type")
+	}
+}
+
+// FileData represents a file uploaded via multipart form; the file is read as a stream.
 type FileData struct {
-	File       multipart.File
-	FileHeader *multipart.FileHeader
+	File        io.Reader
+	FileName    string
+	ContentType string
+}
+
+// DuplicateCluster represents near-duplicate images of a task; Kept is the image counted
+// in the statistics of tasks excluding duplicates.
+type DuplicateCluster struct {
+	Kept   string   `json:"kept"`
+	Images []string `json:"images"`
+}
+
+// UploadLimits bound the uploaded images; zero values leave them unlimited.
+type UploadLimits struct {
+	// MaxImageBytes is the largest size of an uploaded file; a larger file is not read past the limit.
+	MaxImageBytes int64
+
+	// MaxImageSide is the largest width or height of an image in pixels.
+	MaxImageSide int
+
+	// MaxImagePixels is the largest number of pixels of an image.
+	MaxImagePixels int
+
+	// MaxTaskImages is the largest number of images of a task.
+	MaxTaskImages int
+
+	// QuotaBytes is the largest size of the uploaded files of all tasks of a user;
+	// files of the same content count for each image.
+	QuotaBytes int64
+}
+
+// UploadUsage represents the number of images of a task and the size of the files
+// uploaded to all tasks of its owner.
+type UploadUsage struct {
+	TaskImages int   `db:"task_images"`
+	OwnerBytes int64 `db:"owner_bytes"`
+}
+
+// Add returns the usage with the images added.
+func (u UploadUsage) Add(images ...*Image) UploadUsage {
+	for _, image := range images {
+		u.TaskImages++
+		u.OwnerBytes += image.Size
+	}
+
+	return u
+}
+
+// CheckLimits returns tools.ErrUnprocessable if the task has more images than allowed
+// and tools.ErrTooLarge if the files of the owner exceed the quota.
+func (u UploadUsage) CheckLimits(limits UploadLimits) error {
+	if limits.MaxTaskImages > 0 && u.TaskImages > limits.MaxTaskImages {
+		return fmt.Errorf("%w: task can not have more than %d images", tools.ErrUnprocessable, limits.MaxTaskImages)
+	}
+
+	if limits.QuotaBytes > 0 && u.OwnerBytes > limits.QuotaBytes {
+		return fmt.Errorf("%w: storage quota of %d bytes exceeded", tools.ErrTooLarge, limits.QuotaBytes)
+	}
+
+	return nil
+}
+
+// UploadResult represents the outcome of adding an uploaded file to a task.
+type UploadResult struct {
+	FileName  string `json:"fileName"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	ImageName string `json:"imageName,omitempty"`
 }
@@ -0,0 +1,28 @@
+// Package webhook_model defines data structures for webhook callbacks on task completion.
+package webhook_model
+
+import (
+	"face-track/internal/pkg/model/task_model"
+	"time"
+)
+
+// Delivery represents a webhook call with its delivery state; deliveries form the delivery log.
+type Delivery struct {
+	Id           int                `db:"id" json:"id"`
+	TaskId       int                `db:"task_id" json:"taskId"`
+	Url          string             `db:"url" json:"url"`
+	Payload      task_model.RawJSON `db:"payload" json:"payload"`
+	Status       string             `db:"delivery_status" json:"status"`
+	Attempts     int                `db:"attempts" json:"attempts"`
+	ResponseCode int                `db:"response_code" json:"responseCode"`
+	LastError    string             `db:"last_error" json:"lastError,omitempty"`
+}
+
+// Payload is the JSON body sent to the callback URL.
+type Payload struct {
+	TaskId       int                   `json:"taskId"`
+	Status       string                `json:"taskStatus"`
+	StatusReason string                `json:"statusReason,omitempty"`
+	Statistics   task_model.Statistics `json:"statistics"`
+	Timestamp    time.Time             `json:"timestamp"`
+}
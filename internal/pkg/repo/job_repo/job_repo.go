@@ -0,0 +1,446 @@
+// Package job_repo provides methods for managing the Postgres-backed background job queue.
+package job_repo
+
+import (
+	"database/sql"
+	"errors"
+	"face-track/internal/pkg/model/job_model"
+	"face-track/tools"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// JobRepo represents a repository for queueing and claiming background jobs.
+type JobRepo struct {
+	db *sqlx.DB
+}
+
+// New creates a new JobRepo instance with the provided database connection.
+func New(db *sqlx.DB) (repo *JobRepo) {
+	return &JobRepo{
+		db: db,
+	}
+}
+
+// EnqueueTaskJob sets the task status to "in_progress" and queues a job of the given kind for it
+// in a single transaction.
+func (r *JobRepo) EnqueueTaskJob(taskId int, kind string) (err error) {
+	var taskStatus string
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `SELECT 
+				task_status 
+			FROM task 
+			WHERE id=$1 
+			FOR UPDATE`
+
+	err = tx.QueryRow(query, taskId).Scan(&taskStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if taskStatus == "in_progress" {
+		return fmt.Errorf("%w: task is already being processed", tools.ErrConflict)
+	}
+
+	if err = queueTaskJob(tx, taskId, kind); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EnqueueRetryJob queues processing of the task images which are not processed yet and have been tried
+// less than maxAttempts times; failed images become "pending" again, processed images are kept.
+// Only tasks finished with errors can be retried.
+func (r *JobRepo) EnqueueRetryJob(taskId int, maxAttempts int) (err error) {
+	var taskStatus string
+	var result sql.Result
+	var rowsAffected int64
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `SELECT 
+				task_status 
+			FROM task 
+			WHERE id=$1 
+			FOR UPDATE`
+
+	err = tx.QueryRow(query, taskId).Scan(&taskStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if taskStatus != "error" && taskStatus != "completed_with_errors" {
+		return fmt.Errorf("%w: only tasks finished with errors can be retried", tools.ErrConflict)
+	}
+
+	query = `UPDATE task_image 
+				SET image_status='pending', 
+				    error='' 
+				WHERE task_id=$1 AND image_status<>'done' AND attempts < $2`
+
+	result, err = tx.Exec(query, taskId, maxAttempts)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: no images to retry: failed images reached the max attempts", tools.ErrConflict)
+	}
+
+	if err = queueTaskJob(tx, taskId, job_model.KindProcessTask); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// queueTaskJob sets the task status to "in_progress" and inserts a job of the given kind within the transaction.
+func queueTaskJob(tx *sqlx.Tx, taskId int, kind string) (err error) {
+
+	query := `UPDATE task 
+				SET task_status='in_progress', 
+				    status_reason='' 
+				WHERE id=$1`
+
+	if _, err = tx.Exec(query, taskId); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO job 
+				(
+				task_id, 
+				kind
+				) 
+			VALUES ($1, $2) 
+			ON CONFLICT (task_id) WHERE job_status IN ('queued', 'running') DO NOTHING`
+
+	_, err = tx.Exec(query, taskId, kind)
+
+	return err
+}
+
+// CancelTaskJob sets the task status to "cancelled" and cancels its queued job in a single transaction;
+// a running job is stopped by its worker. Returns error if the task is not being processed.
+func (r *JobRepo) CancelTaskJob(taskId int) (err error) {
+	var taskStatus string
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `SELECT 
+				task_status 
+			FROM task 
+			WHERE id=$1 
+			FOR UPDATE`
+
+	err = tx.QueryRow(query, taskId).Scan(&taskStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if taskStatus != "in_progress" {
+		return fmt.Errorf("%w: task is not being processed", tools.ErrConflict)
+	}
+
+	query = `UPDATE task 
+				SET task_status='cancelled', 
+				    status_reason='cancelled by user' 
+				WHERE id=$1`
+
+	if _, err = tx.Exec(query, taskId); err != nil {
+		return err
+	}
+
+	query = `UPDATE job 
+				SET job_status='cancelled', 
+				    updated_at=now() 
+				WHERE task_id=$1 AND job_status='queued'`
+
+	if _, err = tx.Exec(query, taskId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClaimJob takes the oldest queued job, marks it as running and leases its task to the owner
+// for the lease duration; returns tools.ErrNotFound if the queue is empty.
+// Concurrent workers never claim the same job.
+func (r *JobRepo) ClaimJob(owner string, lease time.Duration) (job *job_model.Job, err error) {
+	job = &job_model.Job{}
+
+	query := `WITH claimed AS (
+				UPDATE job 
+				SET job_status='running', 
+				    attempts=attempts+1, 
+				    locked_at=now(), 
+				    updated_at=now() 
+				WHERE id = (
+					SELECT id 
+					FROM job 
+					WHERE job_status='queued' AND run_at <= now() 
+					ORDER BY run_at, id 
+					LIMIT 1 
+					FOR UPDATE SKIP LOCKED
+				) 
+				RETURNING id, task_id, kind, job_status, attempts, last_error
+			), leased AS (
+				UPDATE task 
+				SET lease_owner=$1, 
+				    lease_expires_at=now() + make_interval(secs => $2) 
+				FROM claimed 
+				WHERE task.id = claimed.task_id
+			)
+			SELECT id, task_id, kind, job_status, attempts, last_error FROM claimed`
+
+	err = r.db.QueryRowx(query, owner, lease.Seconds()).StructScan(job)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, err
+}
+
+// ExtendTaskLease prolongs the lease of the task held by the owner; returns tools.ErrNotFound
+// if the owner does not hold the lease anymore or the task is not being processed.
+func (r *JobRepo) ExtendTaskLease(taskId int, owner string, lease time.Duration) (err error) {
+
+	query := `UPDATE task 
+				SET lease_expires_at=now() + make_interval(secs => $3) 
+				WHERE id=$1 AND lease_owner=$2 AND task_status='in_progress'`
+
+	return r.execJobUpdate(query, taskId, owner, lease.Seconds())
+}
+
+// RecoverExpiredTasks finds tasks left "in_progress" by dead workers, i.e. whose lease has expired.
+// Their jobs are queued again unless they reached maxAttempts; then the job fails and the task
+// gets the "error" status with the reason. "in_progress" tasks without any active job get a new job.
+// Returns IDs of resumed and failed tasks.
+func (r *JobRepo) RecoverExpiredTasks(maxAttempts int, reason string) (resumed []int, failed []int, err error) {
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// running jobs of expired leases go back to the queue
+	query := `UPDATE job 
+				SET job_status='queued', 
+				    last_error='worker lease expired', 
+				    locked_at=NULL, 
+				    updated_at=now() 
+				FROM task 
+				WHERE task.id = job.task_id 
+				  AND job.job_status='running' 
+				  AND (task.lease_expires_at IS NULL OR task.lease_expires_at < now()) 
+				  AND job.attempts < $1 
+				RETURNING job.task_id`
+
+	if err = tx.Select(&resumed, query, maxAttempts); err != nil {
+		return nil, nil, err
+	}
+
+	// jobs interrupted too many times fail
+	query = `UPDATE job 
+				SET job_status='failed', 
+				    last_error=$2, 
+				    locked_at=NULL, 
+				    updated_at=now() 
+				FROM task 
+				WHERE task.id = job.task_id 
+				  AND job.job_status='running' 
+				  AND (task.lease_expires_at IS NULL OR task.lease_expires_at < now()) 
+				  AND job.attempts >= $1 
+				RETURNING job.task_id`
+
+	if err = tx.Select(&failed, query, maxAttempts, reason); err != nil {
+		return nil, nil, err
+	}
+
+	if len(failed) > 0 {
+		query, args, err := sqlx.In(`UPDATE task 
+				SET task_status='error', 
+				    status_reason=?, 
+				    lease_owner='', 
+				    lease_expires_at=NULL 
+				WHERE id IN (?) AND task_status='in_progress'`, reason, failed)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// tasks left in progress without a job get a new one
+	var orphans []int
+
+	query = `INSERT INTO job 
+				(
+				task_id, 
+				kind
+				) 
+			SELECT task.id, $1 
+			FROM task 
+			WHERE task.task_status='in_progress' 
+			  AND (task.lease_expires_at IS NULL OR task.lease_expires_at < now()) 
+			  AND NOT EXISTS (
+				SELECT 1 FROM job 
+				WHERE job.task_id = task.id AND job.job_status IN ('queued', 'running')
+			  ) 
+			ON CONFLICT (task_id) WHERE job_status IN ('queued', 'running') DO NOTHING 
+			RETURNING task_id`
+
+	if err = tx.Select(&orphans, query, job_model.KindProcessTask); err != nil {
+		return nil, nil, err
+	}
+
+	resumed = append(resumed, orphans...)
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return resumed, failed, nil
+}
+
+// CompleteJob marks the job as done and releases the lease of its task held by the owner.
+func (r *JobRepo) CompleteJob(job *job_model.Job, owner string) (err error) {
+
+	query := `UPDATE job 
+				SET job_status='done', 
+				    locked_at=NULL, 
+				    updated_at=now() 
+				WHERE id=$1`
+
+	return r.finishJob(job, owner, query, job.Id)
+}
+
+// FailJob marks the job as failed, saves the reason and releases the lease of its task held by the owner.
+func (r *JobRepo) FailJob(job *job_model.Job, owner string, reason string) (err error) {
+
+	query := `UPDATE job 
+				SET job_status='failed', 
+				    last_error=$2, 
+				    locked_at=NULL, 
+				    updated_at=now() 
+				WHERE id=$1`
+
+	return r.finishJob(job, owner, query, job.Id, reason)
+}
+
+// finishJob records the outcome of the job with the query and releases the lease of its task in a single
+// transaction. A running job without a lease is taken for abandoned by RecoverExpiredTasks, so the lease
+// is never released before the outcome is recorded. Returns tools.ErrNotFound if the job does not exist.
+func (r *JobRepo) finishJob(job *job_model.Job, owner string, query string, args ...interface{}) (err error) {
+	var result sql.Result
+	var rowsAffected int64
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	result, err = tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return tools.ErrNotFound
+	}
+
+	query = `UPDATE task 
+				SET lease_owner='', 
+				    lease_expires_at=NULL 
+				WHERE id=$1 AND lease_owner=$2`
+
+	if _, err = tx.Exec(query, job.TaskId, owner); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execJobUpdate executes the update of a single job row; returns tools.ErrNotFound if the job does not exist.
+func (r *JobRepo) execJobUpdate(query string, args ...interface{}) (err error) {
+	var result sql.Result
+	var rowsAffected int64
+
+	result, err = r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return tools.ErrNotFound
+	}
+
+	return err
+}
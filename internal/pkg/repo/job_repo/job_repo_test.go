@@ -0,0 +1,491 @@
+package job_repo_test
+
+import (
+	"database/sql"
+	"errors"
+	"face-track/internal/pkg/model/job_model"
+	"face-track/internal/pkg/repo/job_repo"
+	"face-track/tools"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_JobRepo_ClaimJob(t *testing.T) {
+
+	claimQuery := regexp.QuoteMeta(`WITH claimed AS (
+				UPDATE job 
+				SET job_status='running', 
+				    attempts=attempts+1, 
+				    locked_at=now(), 
+				    updated_at=now() 
+				WHERE id = (
+					SELECT id 
+					FROM job 
+					WHERE job_status='queued' AND run_at <= now() 
+					ORDER BY run_at, id 
+					LIMIT 1 
+					FOR UPDATE SKIP LOCKED
+				) 
+				RETURNING id, task_id, kind, job_status, attempts, last_error
+			), leased AS (
+				UPDATE task 
+				SET lease_owner=$1, 
+				    lease_expires_at=now() + make_interval(secs => $2) 
+				FROM claimed 
+				WHERE task.id = claimed.task_id
+			)
+			SELECT id, task_id, kind, job_status, attempts, last_error FROM claimed`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		want          *job_model.Job
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // no queued jobs
+			name: "fail claim job: queue is empty",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(claimQuery).
+					WithArgs("worker-1", float64(60)).
+					WillReturnError(sql.ErrNoRows)
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success claiming job
+			name: "success claim job",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(claimQuery).
+					WithArgs("worker-1", float64(60)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "kind", "job_status", "attempts", "last_error"}).
+						AddRow(3, 7, job_model.KindProcessTask, "running", 1, ""))
+			},
+			want: &job_model.Job{Id: 3, TaskId: 7, Kind: job_model.KindProcessTask, Status: "running", Attempts: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := job_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			got, err := r.ClaimJob("worker-1", time.Minute)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jobRepo.ClaimJob() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("jobRepo.ClaimJob() error type = %v, want err type %v", err, tt.wantErrorType)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jobRepo.ClaimJob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_JobRepo_EnqueueTaskJob(t *testing.T) {
+
+	selectQuery := regexp.QuoteMeta(`SELECT task_status FROM task WHERE id=$1 FOR UPDATE`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // task with given id not found
+			name: "fail enqueue: task not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // task is already being processed
+			name: "fail enqueue: task in progress",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("in_progress"))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrConflict,
+		},
+		{ // success enqueue
+			name: "success enqueue",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("new"))
+				mockSQL.ExpectExec(`UPDATE task`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectExec(`INSERT INTO job`).WithArgs(1, job_model.KindProcessTask).WillReturnResult(sqlmock.NewResult(1, 1))
+				mockSQL.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := job_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.EnqueueTaskJob(1, job_model.KindProcessTask)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jobRepo.EnqueueTaskJob() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("jobRepo.EnqueueTaskJob() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_JobRepo_EnqueueRetryJob(t *testing.T) {
+
+	selectQuery := regexp.QuoteMeta(`SELECT task_status FROM task WHERE id=$1 FOR UPDATE`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // task with given id not found
+			name: "fail retry: task not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // task finished without errors
+			name: "fail retry: task completed",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("completed"))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrConflict,
+		},
+		{ // all failed images reached max attempts
+			name: "fail retry: no retryable images",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("completed_with_errors"))
+				mockSQL.ExpectExec(`UPDATE task_image`).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrConflict,
+		},
+		{ // success retry
+			name: "success retry",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("error"))
+				mockSQL.ExpectExec(`UPDATE task_image`).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 2))
+				mockSQL.ExpectExec(`UPDATE task`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectExec(`INSERT INTO job`).WithArgs(1, job_model.KindProcessTask).WillReturnResult(sqlmock.NewResult(1, 1))
+				mockSQL.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := job_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.EnqueueRetryJob(1, 3)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jobRepo.EnqueueRetryJob() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("jobRepo.EnqueueRetryJob() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_JobRepo_CancelTaskJob(t *testing.T) {
+
+	selectQuery := regexp.QuoteMeta(`SELECT task_status FROM task WHERE id=$1 FOR UPDATE`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // task with given id not found
+			name: "fail cancel: task not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // task is not being processed
+			name: "fail cancel: task completed",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("completed"))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrConflict,
+		},
+		{ // success cancel
+			name: "success cancel",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status"}).AddRow("in_progress"))
+				mockSQL.ExpectExec(`UPDATE task`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectExec(`UPDATE job`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := job_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.CancelTaskJob(1)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jobRepo.CancelTaskJob() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("jobRepo.CancelTaskJob() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_JobRepo_CompleteJob(t *testing.T) {
+
+	completeQuery := regexp.QuoteMeta(`UPDATE job SET job_status='done', locked_at=NULL, updated_at=now() WHERE id=$1`)
+	failQuery := regexp.QuoteMeta(`UPDATE job SET job_status='failed', last_error=$2, locked_at=NULL, updated_at=now() WHERE id=$1`)
+	releaseQuery := regexp.QuoteMeta(`UPDATE task SET lease_owner='', lease_expires_at=NULL WHERE id=$1 AND lease_owner=$2`)
+
+	job := &job_model.Job{Id: 1, TaskId: 2}
+
+	tests := []struct {
+		name          string
+		fail          bool
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // job with given id not found, the task lease is kept
+			name: "fail complete: job not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectExec(completeQuery).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // the outcome is recorded before the task lease is released
+			name: "success complete",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectExec(completeQuery).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectExec(releaseQuery).WithArgs(2, "worker").WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectCommit()
+			},
+		},
+		{ // the outcome is recorded before the task lease is released
+			name: "success fail",
+			fail: true,
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectExec(failQuery).WithArgs(1, "boom").WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectExec(releaseQuery).WithArgs(2, "worker").WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := job_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			var err error
+			if tt.fail {
+				err = r.FailJob(job, "worker", "boom")
+			} else {
+				err = r.CompleteJob(job, "worker")
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jobRepo.CompleteJob() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("jobRepo.CompleteJob() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_JobRepo_RecoverExpiredTasks(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		beforeTest  func(sqlmock.Sqlmock)
+		wantResumed []int
+		wantFailed  []int
+		wantErr     bool
+	}{
+		{ // database error
+			name: "fail recover: requeue error",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(`UPDATE job`).WithArgs(3).WillReturnError(errors.New("db error"))
+				mockSQL.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{ // expired jobs are requeued or failed, orphaned tasks get a job
+			name: "success recover",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(`UPDATE job`).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"task_id"}).AddRow(1))
+				mockSQL.ExpectQuery(`UPDATE job`).WithArgs(3, "interrupted").
+					WillReturnRows(sqlmock.NewRows([]string{"task_id"}).AddRow(2))
+				mockSQL.ExpectExec(`UPDATE task`).WithArgs("interrupted", 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectQuery(`INSERT INTO job`).WithArgs(job_model.KindProcessTask).
+					WillReturnRows(sqlmock.NewRows([]string{"task_id"}).AddRow(5))
+				mockSQL.ExpectCommit()
+			},
+			wantResumed: []int{1, 5},
+			wantFailed:  []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := job_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			resumed, failed, err := r.RecoverExpiredTasks(3, "interrupted")
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jobRepo.RecoverExpiredTasks() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(resumed, tt.wantResumed) || !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("jobRepo.RecoverExpiredTasks() = %v, %v, want %v, %v", resumed, failed, tt.wantResumed, tt.wantFailed)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
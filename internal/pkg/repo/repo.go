@@ -3,40 +3,90 @@
 package repo
 
 import (
-	"face-track/internal/pkg/model/face_cloud_model"
+	"context"
+	"face-track/internal/pkg/blob_store"
+	"face-track/internal/pkg/detector"
+	"face-track/internal/pkg/model/detector_model"
+	"face-track/internal/pkg/model/job_model"
 	"face-track/internal/pkg/model/task_model"
+	"face-track/internal/pkg/model/webhook_model"
+	"face-track/internal/pkg/repo/job_repo"
 	"face-track/internal/pkg/repo/task_repo"
+	"face-track/internal/pkg/repo/webhook_repo"
 	"image"
+	"io"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// Repo is a struct that embeds the Task interface and allows interaction with task-related functions.
+// Repo is a struct that embeds the Task, Job and Webhook interfaces and allows interaction with task-related
+// functions, the background job queue and webhook deliveries.
 type Repo struct {
 	Task
+	Job
+	Webhook
 }
 
-// NewRepo creates a new instance of Repo, initializing it with the TaskRepo interface implementation.
-func NewRepo(db *sqlx.DB) *Repo {
+// NewRepo creates a new instance of Repo, initializing it with the TaskRepo, JobRepo and WebhookRepo implementations.
+func NewRepo(db *sqlx.DB, detector detector.Detector, store blob_store.BlobStore) *Repo {
 	return &Repo{
-		Task: task_repo.New(db),
+		Task:    task_repo.New(db, detector, store),
+		Job:     job_repo.New(db),
+		Webhook: webhook_repo.New(db),
 	}
 }
 
 // Task defines the interface for interacting with task-related functions.
 type Task interface {
 	GetTaskById(taskId int) (taskRow *task_model.Task, err error)
+	ListTasks(filter *task_model.TaskFilter) (tasks []*task_model.Task, err error)
 	GetTaskImages(taskId int) (images []*task_model.Image, err error)
+	GetTaskImage(taskId int, imageName string) (image *task_model.Image, err error)
 	GetFacesByImageIds(imageIds []int) (taskFaces map[int][]*task_model.Face, err error)
-	CreateTask() (taskId int, err error)
+	CreateTask(request *task_model.CreateTaskRequest) (taskId int, err error)
 	DeleteTask(taskId int) (err error)
-	SaveImageDisk(taskId int, image image.Image, imageName string) (imageRow *task_model.Image, err error)
+	SaveImageFile(taskId int, image image.Image, imageName string, format string, original []byte) (imageRow *task_model.Image, err error)
 	CreateImage(image *task_model.Image) (err error)
-	DecodeFile(fileData *task_model.FileData) (img image.Image, err error)
+	GetUploadUsage(taskId int) (usage *task_model.UploadUsage, err error)
+	CreateImages(taskId int, images []*task_model.Image, limits task_model.UploadLimits) (err error)
+	ReleaseImageBlobs(checksums []string) (err error)
+	DeleteTaskFiles(taskId int) (err error)
+	OpenImageFile(imageRow *task_model.Image) (file io.ReadCloser, err error)
+	DecodeFile(data []byte) (img image.Image, format string, err error)
 	ConfirmTaskStatus(taskId int, status string) (ok bool)
 	UpdateTaskStatus(taskId int, status string) (err error)
-	GetFaceDetectionData(image *task_model.Image, token string) (imageData *face_cloud_model.FaceCloudDetectResponse, err error)
-	GetFaceCloudToken() (token string, err error)
-	SaveProcessedData(processedFaces []*task_model.Face, processedImages []*task_model.Image)
+	SetTaskError(taskId int, reason string) (err error)
+	GetFaceDetectionData(ctx context.Context, image *task_model.Image) (result *detector_model.DetectResult, err error)
+	SaveImageResponse(imageId int, result *detector_model.DetectResult) (err error)
+	CacheDetection(checksum string, result *detector_model.DetectResult) (err error)
+	GetCachedDetection(checksum string) (result *detector_model.DetectResult, err error)
+	GetImageResponses(taskId int) (responses []*task_model.ImageResponse, err error)
+	ParseImageResponse(response *task_model.ImageResponse) (result *detector_model.DetectResult, err error)
+	ReplaceImageFaces(imageIds []int, faces []*task_model.Face) (err error)
+	SaveProcessedData(processedFaces []*task_model.Face, processedImages []*task_model.Image) (err error)
+	SetImageError(imageId int, reason string) (err error)
 	UpdateTaskStatistics(task *task_model.Task) (err error)
+	FinishTask(task *task_model.Task) (err error)
+}
+
+// Job defines the interface for interacting with the background job queue.
+type Job interface {
+	EnqueueTaskJob(taskId int, kind string) (err error)
+	EnqueueRetryJob(taskId int, maxAttempts int) (err error)
+	CancelTaskJob(taskId int) (err error)
+	ClaimJob(owner string, lease time.Duration) (job *job_model.Job, err error)
+	ExtendTaskLease(taskId int, owner string, lease time.Duration) (err error)
+	RecoverExpiredTasks(maxAttempts int, reason string) (resumed []int, failed []int, err error)
+	CompleteJob(job *job_model.Job, owner string) (err error)
+	FailJob(job *job_model.Job, owner string, reason string) (err error)
+}
+
+// Webhook defines the interface for interacting with webhook deliveries.
+type Webhook interface {
+	CreateDelivery(delivery *webhook_model.Delivery) (err error)
+	ClaimDelivery(lease time.Duration) (delivery *webhook_model.Delivery, err error)
+	CompleteDelivery(deliveryId int, responseCode int) (err error)
+	RetryDelivery(deliveryId int, responseCode int, reason string, delay time.Duration) (err error)
+	FailDelivery(deliveryId int, responseCode int, reason string) (err error)
 }
@@ -0,0 +1,114 @@
+package task_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"face-track/internal/pkg/model/task_model"
+)
+
+// acquireImageBlob adds a reference to the files of the image content, registering the content under the keys
+// of the image if it is new; the keys of the image are set to the keys the content is stored under.
+// Returns whether the files are stored already.
+func (r *TaskRepo) acquireImageBlob(imageRow *task_model.Image) (stored bool, err error) {
+
+	query := `INSERT INTO image_blob 
+				(
+				checksum, 
+				original_key, 
+				rendition_key, 
+				ref_count
+				) 
+			VALUES ($1, $2, $3, 1) 
+			ON CONFLICT (checksum) DO UPDATE 
+			SET ref_count = image_blob.ref_count + 1 
+			RETURNING stored, original_key, rendition_key`
+
+	err = r.db.QueryRow(query, imageRow.Checksum, imageRow.OriginalKey, imageRow.RenditionKey).
+		Scan(&stored, &imageRow.OriginalKey, &imageRow.RenditionKey)
+
+	return stored, err
+}
+
+// markImageBlobStored records that the files of the content are in the blob store.
+func (r *TaskRepo) markImageBlobStored(checksum string) (err error) {
+
+	query := `UPDATE image_blob SET stored=true WHERE checksum=$1`
+
+	_, err = r.db.Exec(query, checksum)
+
+	return err
+}
+
+// ReleaseImageBlobs drops a reference to the files of each checksum, one per image of the content;
+// contents no longer referenced are unregistered along with the cached detection results, and their files
+// are removed from the blob store once that is committed. Checksums of files stored under the task prefix are ignored.
+// The content stored again meanwhile gets new keys, so its files are not affected.
+func (r *TaskRepo) ReleaseImageBlobs(checksums []string) (err error) {
+	var released []string
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, checksum := range checksums {
+		var refCount int
+		var originalKey, renditionKey string
+
+		query := `UPDATE image_blob 
+				SET ref_count = ref_count - 1 
+				WHERE checksum=$1 
+				RETURNING ref_count, original_key, rendition_key`
+
+		err = tx.QueryRow(query, checksum).Scan(&refCount, &originalKey, &renditionKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if refCount > 0 {
+			continue
+		}
+
+		if _, err = tx.Exec(`DELETE FROM image_blob WHERE checksum=$1`, checksum); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM detection_cache WHERE checksum=$1`, checksum); err != nil {
+			return err
+		}
+
+		released = append(released, originalKey)
+		if renditionKey != originalKey {
+			released = append(released, renditionKey)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// the files are no longer referenced, a file failed to be removed is only left behind
+	return r.deleteFiles(released)
+}
+
+// deleteFiles removes the files from the blob store; returns the first error after trying all of them.
+func (r *TaskRepo) deleteFiles(keys []string) (err error) {
+	ctx := context.Background()
+
+	for _, key := range keys {
+		if deleteErr := r.store.Delete(ctx, key); deleteErr != nil && err == nil {
+			err = deleteErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package task_repo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"face-track/internal/pkg/blob_store/local_store"
+	"face-track/internal/pkg/imaging"
+	"face-track/internal/pkg/repo/task_repo"
+	"face-track/tools"
+	"image"
+	"image/png"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_TaskRepo_ImageFiles(t *testing.T) {
+
+	acquireQuery := regexp.QuoteMeta(`INSERT INTO image_blob
+				(
+				checksum,
+				original_key,
+				rendition_key,
+				ref_count
+				)
+			VALUES ($1, $2, $3, 1)
+			ON CONFLICT (checksum) DO UPDATE
+			SET ref_count = image_blob.ref_count + 1
+			RETURNING stored, original_key, rendition_key`)
+	releaseQuery := regexp.QuoteMeta(`UPDATE image_blob
+				SET ref_count = ref_count - 1
+				WHERE checksum=$1
+				RETURNING ref_count, original_key, rendition_key`)
+
+	mockDB, mockSQL, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	store := local_store.New(t.TempDir())
+	r := task_repo.New(sqlx.NewDb(mockDB, "sqlmock"), nil, store)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	var original bytes.Buffer
+	if err := png.Encode(&original, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first upload of the content stores the files under the keys it is registered with
+	mockSQL.ExpectQuery(acquireQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"stored", "original_key", "rendition_key"}).
+			AddRow(false, "blobs/ab/photo.png", "blobs/ab/photo.jpg"))
+	mockSQL.ExpectExec(regexp.QuoteMeta(`UPDATE image_blob SET stored=true WHERE checksum=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	first, err := r.SaveImageFile(7, img, "photo.png", imaging.FormatPNG, original.Bytes())
+	if err != nil {
+		t.Fatalf("taskRepo.SaveImageFile() error = %v", err)
+	}
+
+	if first.OriginalKey != "blobs/ab/photo.png" || first.RenditionKey != "blobs/ab/photo.jpg" ||
+		first.Width != 4 || first.Height != 3 {
+		t.Errorf("taskRepo.SaveImageFile() = %+v, want the registered keys and the image size", first)
+	}
+
+	// the same content uploaded to another task shares the files
+	mockSQL.ExpectQuery(acquireQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"stored", "original_key", "rendition_key"}).
+			AddRow(true, first.OriginalKey, first.RenditionKey))
+
+	second, err := r.SaveImageFile(8, img, "copy.png", imaging.FormatPNG, original.Bytes())
+	if err != nil {
+		t.Fatalf("taskRepo.SaveImageFile() error = %v", err)
+	}
+
+	if second.OriginalKey != first.OriginalKey || second.Checksum != first.Checksum {
+		t.Errorf("taskRepo.SaveImageFile() = %+v, want the files of %+v", second, first)
+	}
+
+	// the original is kept verbatim
+	file, err := r.OpenImageFile(second)
+	if err != nil {
+		t.Fatalf("taskRepo.OpenImageFile() error = %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	_ = file.Close()
+	if !bytes.Equal(data, original.Bytes()) {
+		t.Errorf("taskRepo.OpenImageFile() returned %d bytes, want the original %d bytes", len(data), original.Len())
+	}
+
+	keys, _ := store.List(context.Background(), "blobs/")
+	if len(keys) != 2 {
+		t.Errorf("taskRepo.SaveImageFile() stored %v, want the original and the rendition", keys)
+	}
+
+	// the files are kept until the release is committed
+	mockSQL.ExpectBegin()
+	mockSQL.ExpectQuery(releaseQuery).WithArgs(first.Checksum).
+		WillReturnRows(sqlmock.NewRows([]string{"ref_count", "original_key", "rendition_key"}).
+			AddRow(0, first.OriginalKey, first.RenditionKey))
+	mockSQL.ExpectExec(regexp.QuoteMeta(`DELETE FROM image_blob WHERE checksum=$1`)).WithArgs(first.Checksum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockSQL.ExpectExec(regexp.QuoteMeta(`DELETE FROM detection_cache WHERE checksum=$1`)).WithArgs(first.Checksum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockSQL.ExpectCommit().WillReturnError(errors.New("whoops, error"))
+
+	if err = r.ReleaseImageBlobs([]string{first.Checksum}); err == nil {
+		t.Fatalf("taskRepo.ReleaseImageBlobs() error = nil, want the commit error")
+	}
+
+	keys, _ = store.List(context.Background(), "blobs/")
+	if len(keys) != 2 {
+		t.Errorf("taskRepo.ReleaseImageBlobs() left %v, want the files kept", keys)
+	}
+
+	// the files are removed with the last reference
+	mockSQL.ExpectBegin()
+	mockSQL.ExpectQuery(releaseQuery).WithArgs(first.Checksum).
+		WillReturnRows(sqlmock.NewRows([]string{"ref_count", "original_key", "rendition_key"}).
+			AddRow(1, first.OriginalKey, first.RenditionKey))
+	mockSQL.ExpectQuery(releaseQuery).WithArgs(first.Checksum).
+		WillReturnRows(sqlmock.NewRows([]string{"ref_count", "original_key", "rendition_key"}).
+			AddRow(0, first.OriginalKey, first.RenditionKey))
+	mockSQL.ExpectExec(regexp.QuoteMeta(`DELETE FROM image_blob WHERE checksum=$1`)).WithArgs(first.Checksum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockSQL.ExpectExec(regexp.QuoteMeta(`DELETE FROM detection_cache WHERE checksum=$1`)).WithArgs(first.Checksum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockSQL.ExpectCommit()
+
+	if err = r.ReleaseImageBlobs([]string{first.Checksum, second.Checksum}); err != nil {
+		t.Fatalf("taskRepo.ReleaseImageBlobs() error = %v", err)
+	}
+
+	if _, err = r.OpenImageFile(first); !errors.Is(err, tools.ErrNotFound) {
+		t.Errorf("taskRepo.OpenImageFile() of released image error = %v, want %v", err, tools.ErrNotFound)
+	}
+
+	if err := mockSQL.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
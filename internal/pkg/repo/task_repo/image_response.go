@@ -0,0 +1,152 @@
+package task_repo
+
+import (
+	"database/sql"
+	"errors"
+	"face-track/internal/pkg/model/detector_model"
+	"face-track/internal/pkg/model/task_model"
+	"face-track/tools"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveImageResponse saves the raw detection response of an image, replacing the previous one.
+func (r *TaskRepo) SaveImageResponse(imageId int, result *detector_model.DetectResult) (err error) {
+
+	query := `INSERT INTO image_response 
+				(
+				image_id, 
+				provider, 
+				rotation, 
+				response
+				) 
+			VALUES ($1, $2, $3, $4) 
+			ON CONFLICT (image_id) DO UPDATE 
+			SET provider = EXCLUDED.provider, 
+			    rotation = EXCLUDED.rotation, 
+			    response = EXCLUDED.response, 
+			    created_at = now()`
+
+	_, err = r.db.Exec(query, imageId, r.detector.Name(), result.Rotation, task_model.RawJSON(result.Raw))
+
+	return err
+}
+
+// GetImageResponses retrieves raw detection responses of all task images.
+func (r *TaskRepo) GetImageResponses(taskId int) (responses []*task_model.ImageResponse, err error) {
+
+	query := `SELECT 
+				r.id, 
+				r.image_id, 
+				i.image_name, 
+				r.provider, 
+				r.rotation, 
+				r.response, 
+				r.created_at 
+			FROM image_response r 
+			JOIN task_image i ON i.id = r.image_id 
+			WHERE i.task_id=$1 
+			ORDER BY r.image_id`
+
+	if err = r.db.Select(&responses, query, taskId); err != nil {
+		return nil, err
+	}
+
+	return responses, err
+}
+
+// ParseImageResponse rebuilds the detection result from a stored raw response.
+func (r *TaskRepo) ParseImageResponse(response *task_model.ImageResponse) (result *detector_model.DetectResult, err error) {
+
+	if response.Provider != r.detector.Name() {
+		return nil, fmt.Errorf("response of %s provider can not be parsed by %s detector", response.Provider, r.detector.Name())
+	}
+
+	return r.detector.Parse(response.Response)
+}
+
+// ReplaceImageFaces replaces faces of the given images and marks the images as "done" in a single transaction.
+func (r *TaskRepo) ReplaceImageFaces(imageIds []int, faces []*task_model.Face) (err error) {
+
+	if len(imageIds) == 0 {
+		return errors.New("no images to replace faces of")
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query, args, err := sqlx.In(`DELETE FROM face WHERE image_id IN (?)`, imageIds)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	if len(faces) > 0 {
+		if _, err = tx.NamedExec(insertFaceQuery, faces); err != nil {
+			return err
+		}
+	}
+
+	query, args, err = sqlx.In(`UPDATE task_image SET image_status='done', error='' WHERE id IN (?)`, imageIds)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CacheDetection saves the detection result of the image content with the given checksum,
+// so images of the same content are not sent to the detector again.
+func (r *TaskRepo) CacheDetection(checksum string, result *detector_model.DetectResult) (err error) {
+
+	query := `INSERT INTO detection_cache 
+				(
+				checksum, 
+				provider, 
+				rotation, 
+				response
+				) 
+			VALUES ($1, $2, $3, $4) 
+			ON CONFLICT (checksum, provider) DO UPDATE 
+			SET rotation = EXCLUDED.rotation, 
+			    response = EXCLUDED.response, 
+			    created_at = now()`
+
+	_, err = r.db.Exec(query, checksum, r.detector.Name(), result.Rotation, task_model.RawJSON(result.Raw))
+
+	return err
+}
+
+// GetCachedDetection returns the detection result cached for the image content with the given checksum
+// by the current detector; returns tools.ErrNotFound if the content was not analyzed yet.
+func (r *TaskRepo) GetCachedDetection(checksum string) (result *detector_model.DetectResult, err error) {
+	var response task_model.RawJSON
+
+	query := `SELECT 
+				response 
+			FROM detection_cache 
+			WHERE checksum=$1 AND provider=$2`
+
+	err = r.db.QueryRow(query, checksum, r.detector.Name()).Scan(&response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.detector.Parse(response)
+}
@@ -0,0 +1,125 @@
+package task_repo
+
+import (
+	"face-track/internal/pkg/model/task_model"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// taskSortColumns maps sort fields of the task list to the columns and the types of their cursor values.
+var taskSortColumns = map[string]struct{ column, cast string }{
+	"id":         {"id", "int"},
+	"createdAt":  {"created_at", "timestamptz"},
+	"updatedAt":  {"updated_at", "timestamptz"},
+	"facesTotal": {"faces_total", "int"},
+}
+
+// ListTasks retrieves a page of tasks matching the filter, sorted by the filter sort field and ID.
+// The page starts after the filter cursor and holds up to the filter limit of tasks.
+func (r *TaskRepo) ListTasks(filter *task_model.TaskFilter) (tasks []*task_model.Task, err error) {
+	var where []string
+	var args []interface{}
+
+	// addCondition adds the condition with the argument placeholder formatted in
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(filter.Statuses) > 0 {
+		addCondition("task_status::text = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		addCondition("created_at >= $%d", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		addCondition("created_at < $%d", filter.CreatedTo)
+	}
+	if !filter.UpdatedFrom.IsZero() {
+		addCondition("updated_at >= $%d", filter.UpdatedFrom)
+	}
+	if !filter.UpdatedTo.IsZero() {
+		addCondition("updated_at < $%d", filter.UpdatedTo)
+	}
+	if filter.FacesMin != nil {
+		addCondition("faces_total >= $%d", *filter.FacesMin)
+	}
+	if filter.FacesMax != nil {
+		addCondition("faces_total <= $%d", *filter.FacesMax)
+	}
+
+	sort, ok := taskSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field: %s", filter.Sort)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Order == "desc" {
+		direction, comparison = "DESC", "<"
+	}
+
+	// keyset pagination: continue after the cursor task in the sort order
+	if filter.After != nil {
+		args = append(args, filter.After.Value, filter.After.Id)
+		where = append(where, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)",
+			sort.column, comparison, len(args)-1, sort.cast, len(args)))
+	}
+
+	query := `SELECT 
+				id, 
+				task_status, 
+				status_reason, 
+				faces_total, 
+				faces_female, 
+				faces_male, 
+				age_female_avg, 
+				age_male_avg, 
+				callback_url, 
+				exclude_duplicates, 
+				created_at, 
+				updated_at 
+			FROM task`
+
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", sort.column, direction, direction, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks = make([]*task_model.Task, 0, filter.Limit)
+
+	for rows.Next() {
+		task := &task_model.Task{}
+
+		err = rows.Scan(
+			&task.Id,
+			&task.Status,
+			&task.StatusReason,
+			&task.Statistics.FacesTotal,
+			&task.Statistics.FacesFemale,
+			&task.Statistics.FacesMale,
+			&task.Statistics.AgeFemaleAvg,
+			&task.Statistics.AgeMaleAvg,
+			&task.CallbackUrl,
+			&task.ExcludeDuplicates,
+			&task.CreatedAt,
+			&task.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
@@ -0,0 +1,125 @@
+package task_repo_test
+
+import (
+	"errors"
+	"face-track/internal/pkg/model/task_model"
+	"face-track/internal/pkg/repo/task_repo"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func Test_TaskRepo_ListTasks(t *testing.T) {
+
+	selectQuery := `SELECT 
+				id, 
+				task_status, 
+				status_reason, 
+				faces_total, 
+				faces_female, 
+				faces_male, 
+				age_female_avg, 
+				age_male_avg, 
+				callback_url, 
+				exclude_duplicates, 
+				created_at, 
+				updated_at 
+			FROM task`
+
+	columns := []string{"id", "task_status", "status_reason", "faces_total", "faces_female", "faces_male", "age_female_avg", "age_male_avg", "callback_url", "exclude_duplicates", "created_at", "updated_at"}
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	facesMin := 2
+
+	tests := []struct {
+		name       string
+		filter     *task_model.TaskFilter
+		beforeTest func(sqlmock.Sqlmock)
+		want       []*task_model.Task
+		wantErr    bool
+	}{
+		{ // unknown sort field
+			name:    "fail list tasks: unknown sort",
+			filter:  &task_model.TaskFilter{Sort: "name", Limit: 10},
+			wantErr: true,
+		},
+		{ // database error
+			name:   "fail list tasks",
+			filter: &task_model.TaskFilter{Sort: "id", Order: "asc", Limit: 10},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(regexp.QuoteMeta(selectQuery + ` ORDER BY id ASC, id ASC LIMIT $1`)).
+					WithArgs(10).
+					WillReturnError(errors.New("db error"))
+			},
+			wantErr: true,
+		},
+		{ // filters and the cursor make up the condition
+			name: "success list tasks",
+			filter: &task_model.TaskFilter{
+				Statuses:    []string{"completed", "error"},
+				CreatedFrom: createdAt,
+				FacesMin:    &facesMin,
+				Sort:        "createdAt",
+				Order:       "desc",
+				Limit:       2,
+				After:       &task_model.TaskCursor{Sort: "createdAt", Value: "2024-02-01T00:00:00Z", Id: 9},
+			},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(regexp.QuoteMeta(selectQuery+
+					` WHERE task_status::text = ANY($1) AND created_at >= $2 AND faces_total >= $3`+
+					` AND (created_at, id) < ($4::timestamptz, $5) ORDER BY created_at DESC, id DESC LIMIT $6`)).
+					WithArgs(pq.Array([]string{"completed", "error"}), createdAt, 2, "2024-02-01T00:00:00Z", 9, 2).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow(5, "completed", "", 3, 1, 2, 30, 40, "", false, createdAt, createdAt))
+			},
+			want: []*task_model.Task{{
+				Id:        5,
+				Status:    "completed",
+				CreatedAt: createdAt,
+				UpdatedAt: createdAt,
+				Statistics: task_model.Statistics{
+					FacesTotal:   3,
+					FacesFemale:  1,
+					FacesMale:    2,
+					AgeFemaleAvg: 30,
+					AgeMaleAvg:   40,
+				},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			got, err := r.ListTasks(tt.filter)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.ListTasks() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("taskRepo.ListTasks() = %v, want %v", got, tt.want)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
@@ -1,19 +1,25 @@
 // Package task_repo provides methods for managing tasks related data in the database, and interacting
-// with the Face Cloud API for face detection and processing.
+// with the face detection backend for processing.
 package task_repo
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/json"
+	"encoding/hex"
 	"errors"
-	"face-track/internal/pkg/clients/face_cloud_client"
-	"face-track/internal/pkg/model/face_cloud_model"
+	"face-track/internal/pkg/blob_store"
+	"face-track/internal/pkg/detector"
+	"face-track/internal/pkg/imaging"
+	"face-track/internal/pkg/model/detector_model"
 	"face-track/internal/pkg/model/task_model"
 	"face-track/tools"
 	"fmt"
 	"image"
-	"os"
+	"io"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -22,27 +28,79 @@ import (
 const (
 	// foldersAmount defines the maximum number of nested folders for organizing images.
 	foldersAmount = 30000
-
-	// faceCloudApiUrlEnvName is the env variable key for the Face Cloud API URL.
-	faceCloudApiUrlEnvName = "FACE_CLOUD__API_URL"
-
-	// faceCloudUserEnvName is the env variable key for the Face Cloud API user's email.
-	faceCloudUserEnvName = "FACE_CLOUD__API_USER"
-
-	// faceCloudPasswordEnvName is the env variable key for the Face Cloud API user's password.
-	faceCloudPasswordEnvName = "FACE_CLOUD__API_PASS"
 )
 
+// insertFaceQuery inserts a face row; used with NamedExec.
+const insertFaceQuery = `INSERT INTO face 
+				(
+				image_id, 
+				gender, 
+				age, 
+				bbox_height, 
+				bbox_width, 
+				bbox_x, 
+				bbox_y, 
+				age_variance, 
+				ethnicity, 
+				score, 
+				liveness, 
+				facial_hair, 
+				glasses, 
+				hair_color, 
+				hair_type, 
+				headwear, 
+				landmarks, 
+				mask_full_face, 
+				mask_lower_face, 
+				mask_none, 
+				mask_other, 
+				quality_blurriness, 
+				quality_overexposure, 
+				quality_underexposure
+				) 
+			VALUES 
+				(
+				:image_id, 
+				:gender, 
+				:age, 
+				:bbox_height, 
+				:bbox_width, 
+				:bbox_x, 
+				:bbox_y, 
+				:age_variance, 
+				:ethnicity, 
+				:score, 
+				:liveness, 
+				:facial_hair, 
+				:glasses, 
+				:hair_color, 
+				:hair_type, 
+				:headwear, 
+				:landmarks, 
+				:mask_full_face, 
+				:mask_lower_face, 
+				:mask_none, 
+				:mask_other, 
+				:quality_blurriness, 
+				:quality_overexposure, 
+				:quality_underexposure
+			)`
+
 // TaskRepo represents a repository for managing tasks and interacting with the database.
-// It provides methods for CRUD operations on tasks, image management, and communication with the Face Cloud API.
+// It provides methods for CRUD operations on tasks, image management, and communication with the face detector.
+// Image files are kept in the blob store.
 type TaskRepo struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	detector detector.Detector
+	store    blob_store.BlobStore
 }
 
-// New creates a new TaskRepo instance with the provided database connection.
-func New(db *sqlx.DB) (repo *TaskRepo) {
+// New creates a new TaskRepo instance with the provided database connection, face detector and blob store.
+func New(db *sqlx.DB, detector detector.Detector, store blob_store.BlobStore) (repo *TaskRepo) {
 	return &TaskRepo{
-		db: db,
+		db:       db,
+		detector: detector,
+		store:    store,
 	}
 }
 
@@ -53,22 +111,32 @@ func (r *TaskRepo) GetTaskById(taskId int) (task *task_model.Task, err error) {
 	query := `SELECT 
 				id, 
 				task_status, 
+				status_reason, 
 				faces_total, 
 				faces_female, 
 				faces_male, 
 				age_female_avg, 
-				age_male_avg 
+				age_male_avg, 
+				callback_url, 
+				exclude_duplicates, 
+				created_at, 
+				updated_at 
 			FROM task 
 			WHERE id=$1`
 
 	err = r.db.QueryRow(query, taskId).Scan(
 		&task.Id,
 		&task.Status,
+		&task.StatusReason,
 		&task.Statistics.FacesTotal,
 		&task.Statistics.FacesFemale,
 		&task.Statistics.FacesMale,
 		&task.Statistics.AgeFemaleAvg,
 		&task.Statistics.AgeMaleAvg,
+		&task.CallbackUrl,
+		&task.ExcludeDuplicates,
+		&task.CreatedAt,
+		&task.UpdatedAt,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, tools.ErrNotFound
@@ -87,7 +155,18 @@ func (r *TaskRepo) GetTaskImages(taskId int) (images []*task_model.Image, err er
 				id, 
 				task_id, 
 				image_name, 
-				done 
+				original_key, 
+				rendition_key, 
+				image_format, 
+				checksum, 
+				size_bytes, 
+				orientation, 
+				width, 
+				height, 
+				dhash, 
+				image_status, 
+				error, 
+				attempts 
 			FROM task_image 
 			WHERE task_id=$1`
 
@@ -98,6 +177,40 @@ func (r *TaskRepo) GetTaskImages(taskId int) (images []*task_model.Image, err er
 	return images, err
 }
 
+// GetTaskImage retrieves the image of the task by its name; returns tools.ErrNotFound if there is no such image.
+func (r *TaskRepo) GetTaskImage(taskId int, imageName string) (image *task_model.Image, err error) {
+	image = &task_model.Image{}
+
+	query := `SELECT 
+				id, 
+				task_id, 
+				image_name, 
+				original_key, 
+				rendition_key, 
+				image_format, 
+				checksum, 
+				size_bytes, 
+				orientation, 
+				width, 
+				height, 
+				dhash, 
+				image_status, 
+				error, 
+				attempts 
+			FROM task_image 
+			WHERE task_id=$1 AND image_name=$2`
+
+	err = r.db.Get(image, query, taskId, imageName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return image, err
+}
+
 // GetFacesByImageIds retrieves faces associated with the given image IDs.
 func (r *TaskRepo) GetFacesByImageIds(imageIds []int) (taskFaces map[int][]*task_model.Face, err error) {
 	var rows *sqlx.Rows
@@ -112,7 +225,24 @@ func (r *TaskRepo) GetFacesByImageIds(imageIds []int) (taskFaces map[int][]*task
 				bbox_height, 
 				bbox_width, 
 				bbox_x, 
-				bbox_y 
+				bbox_y, 
+				age_variance, 
+				ethnicity, 
+				score, 
+				liveness, 
+				facial_hair, 
+				glasses, 
+				hair_color, 
+				hair_type, 
+				headwear, 
+				landmarks, 
+				mask_full_face, 
+				mask_lower_face, 
+				mask_none, 
+				mask_other, 
+				quality_blurriness, 
+				quality_overexposure, 
+				quality_underexposure 
 			FROM face 
 			WHERE image_id IN (?)`
 
@@ -139,6 +269,23 @@ func (r *TaskRepo) GetFacesByImageIds(imageIds []int) (taskFaces map[int][]*task
 			&face.Bbox.Width,
 			&face.Bbox.X,
 			&face.Bbox.Y,
+			&face.AgeVariance,
+			&face.Ethnicity,
+			&face.Score,
+			&face.Liveness,
+			&face.Attributes.FacialHair,
+			&face.Attributes.Glasses,
+			&face.Attributes.HairColor,
+			&face.Attributes.HairType,
+			&face.Attributes.Headwear,
+			&face.Landmarks,
+			&face.Masks.FullFaceMask,
+			&face.Masks.LowerFaceMask,
+			&face.Masks.NoMask,
+			&face.Masks.OtherMask,
+			&face.Quality.Blurriness,
+			&face.Quality.Overexposure,
+			&face.Quality.Underexposure,
 		); err != nil {
 			return nil, err
 		}
@@ -153,7 +300,9 @@ func (r *TaskRepo) GetFacesByImageIds(imageIds []int) (taskFaces map[int][]*task
 }
 
 // CreateTask creates a new task and returns the task ID.
-func (r *TaskRepo) CreateTask() (taskId int, err error) {
+// The callback URL is notified when the task processing finishes; may be empty.
+// Near-duplicate images are left out of the statistics if requested.
+func (r *TaskRepo) CreateTask(request *task_model.CreateTaskRequest) (taskId int, err error) {
 
 	query := `INSERT INTO task 
 				(
@@ -162,12 +311,15 @@ func (r *TaskRepo) CreateTask() (taskId int, err error) {
 				faces_female, 
 				faces_male, 
 				age_female_avg, 
-				age_male_avg
+				age_male_avg, 
+				callback_url, 
+				exclude_duplicates, 
+				owner
 				) 
-			VALUES ('new', 0, 0, 0, 0, 0) 
+			VALUES ('new', 0, 0, 0, 0, 0, $1, $2, $3) 
 			RETURNING id`
 
-	row := r.db.QueryRowx(query)
+	row := r.db.QueryRowx(query, request.CallbackUrl, request.ExcludeDuplicates, request.Owner)
 	if err = row.Scan(&taskId); err != nil {
 		return 0, err
 	}
@@ -199,35 +351,92 @@ func (r *TaskRepo) DeleteTask(taskId int) (err error) {
 	return err
 }
 
-// SaveImageDisk saves an image to disk and returns an image record with task ID and image name.
-func (r *TaskRepo) SaveImageDisk(taskId int, image image.Image, imageName string) (imageRow *task_model.Image, err error) {
+// SaveImageFile saves the uploaded file to the blob store verbatim along with the JPEG rendition sent
+// to the detector, and returns an image record with task ID, file keys and the SHA-256 checksum of the file.
+// Files are stored under keys derived from the checksum and shared by images of the same content:
+// the reference to the files is acquired here and must be released with ReleaseImageBlobs
+// if the image is not registered or when it is deleted.
+// The rendition is turned upright according to the EXIF orientation; upright JPEG files are sent
+// to the detector as they are. The perceptual hash of the upright image is computed to find near-duplicates.
+func (r *TaskRepo) SaveImageFile(taskId int, image image.Image, imageName string, format string, original []byte) (imageRow *task_model.Image, err error) {
+	ctx := context.Background()
 
 	// Create unique file name
 	uniqueFileName := getUniqueFilename(imageName)
+	baseName := strings.TrimSuffix(uniqueFileName, filepath.Ext(uniqueFileName))
+
+	sum := sha256.Sum256(original)
+	checksum := hex.EncodeToString(sum[:])
+	generation := time.Now().UnixNano()
+	orientation := imaging.Orientation(original, format)
+	upright := imaging.Orient(image, orientation)
 
 	imageRow = &task_model.Image{
-		TaskId:    taskId,
-		ImageName: uniqueFileName,
+		TaskId:       taskId,
+		ImageName:    baseName + imaging.Extension(format),
+		OriginalKey:  blobKey(checksum, generation, imaging.Extension(format)),
+		RenditionKey: blobKey(checksum, generation, imaging.Extension(format)),
+		Format:       format,
+		Checksum:     checksum,
+		Size:         int64(len(original)),
+		Orientation:  orientation,
+		Width:        upright.Bounds().Dx(),
+		Height:       upright.Bounds().Dy(),
+		DHash:        fmt.Sprintf("%016x", imaging.DHash(upright)),
+	}
+
+	if format != imaging.FormatJPEG || orientation != 1 {
+		imageRow.RenditionKey = blobKey(checksum, generation, imaging.Extension(imaging.FormatJPEG))
+		if orientation != 1 {
+			// the key differs from the original one of JPEG files
+			imageRow.RenditionKey = blobKey(checksum, generation, "_upright"+imaging.Extension(imaging.FormatJPEG))
+		}
 	}
 
-	path := r.getImagePath(imageRow)
+	stored, err := r.acquireImageBlob(imageRow)
+	if err != nil {
+		return nil, err
+	}
+	if stored {
+		return imageRow, nil
+	}
+
+	defer func() {
+		if err != nil {
+			_ = r.ReleaseImageBlobs([]string{checksum})
+		}
+	}()
 
-	if err := tools.SaveImg(image, path); err != nil {
+	if err = r.store.Put(ctx, imageRow.OriginalKey, original); err != nil {
 		return nil, err
 	}
 
-	return imageRow, nil
-}
+	if imageRow.RenditionKey != imageRow.OriginalKey {
+		var rendition bytes.Buffer
+		if err = imaging.EncodeJPEG(&rendition, upright); err != nil {
+			return nil, err
+		}
+		if err = r.store.Put(ctx, imageRow.RenditionKey, rendition.Bytes()); err != nil {
+			return nil, err
+		}
+	}
 
-func (r *TaskRepo) getImagePath(imageRow *task_model.Image) (path string) {
+	if err = r.markImageBlobStored(checksum); err != nil {
+		return nil, err
+	}
 
-	homeDir, _ := os.UserHomeDir() // Get the home directory
-	subFolderID := imageRow.TaskId % foldersAmount
-	folderToSave := fmt.Sprintf("%s/face-track/images/%d/%d", homeDir, subFolderID, imageRow.TaskId)
+	return imageRow, nil
+}
 
-	tools.CreateFolderIfNotExist(folderToSave) // Ensure folder exists
+// taskKeyPrefix returns the blob key prefix of the files uploaded before they were stored by content.
+func taskKeyPrefix(taskId int) string {
+	return fmt.Sprintf("%d/%d/", taskId%foldersAmount, taskId)
+}
 
-	return fmt.Sprintf("%s/%s", folderToSave, imageRow.ImageName)
+// blobKey returns the blob key of the file of the content with the given checksum. The generation tells apart
+// the files of the content stored again after it was released, as the released files are removed later.
+func blobKey(checksum string, generation int64, suffix string) string {
+	return fmt.Sprintf("blobs/%s/%s_%d%s", checksum[:2], checksum, generation, suffix)
 }
 
 func getUniqueFilename(filename string) string {
@@ -268,15 +477,144 @@ func (r *TaskRepo) CreateImage(image *task_model.Image) (err error) {
 	return err
 }
 
-// DecodeFile decodes the image file from the provided file data and returns the decoded image.
-func (r *TaskRepo) DecodeFile(fileData *task_model.FileData) (img image.Image, err error) {
+// DeleteTaskFiles removes the files stored under the task prefix from the blob store.
+// Files stored by content are removed by ReleaseImageBlobs.
+func (r *TaskRepo) DeleteTaskFiles(taskId int) (err error) {
+	ctx := context.Background()
 
-	img, _, err = image.Decode(fileData.File)
+	keys, err := r.store.List(ctx, taskKeyPrefix(taskId))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = r.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OpenImageFile opens the uploaded file of the image.
+func (r *TaskRepo) OpenImageFile(imageRow *task_model.Image) (file io.ReadCloser, err error) {
+	file, _, err = r.store.Get(context.Background(), imageRow.OriginalKey)
+	return file, err
+}
+
+// uploadUsageQuery selects the upload usage of the task and its owner.
+const uploadUsageQuery = `SELECT 
+				(SELECT COUNT(*) FROM task_image WHERE task_id=t.id) AS task_images, 
+				COALESCE((
+					SELECT SUM(i.size_bytes) 
+					FROM task_image i 
+					JOIN task o ON o.id = i.task_id 
+					WHERE o.owner = t.owner
+				), 0) AS owner_bytes 
+			FROM task t 
+			WHERE t.id=$1`
+
+// GetUploadUsage returns the number of images of the task and the size of the files uploaded
+// to all tasks of its owner.
+func (r *TaskRepo) GetUploadUsage(taskId int) (usage *task_model.UploadUsage, err error) {
+	usage = &task_model.UploadUsage{}
+
+	err = r.db.Get(usage, uploadUsageQuery, taskId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return img, err
+	return usage, err
+}
+
+// CreateImages inserts image records of the task into the task_image table in a single transaction;
+// returns error if the task status does not allow adding images or the images exceed the upload limits.
+func (r *TaskRepo) CreateImages(taskId int, images []*task_model.Image, limits task_model.UploadLimits) (err error) {
+	var taskStatus, owner string
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `SELECT 
+				task_status, 
+				owner 
+			FROM task 
+			WHERE id=$1 
+			FOR UPDATE`
+
+	err = tx.QueryRow(query, taskId).Scan(&taskStatus, &owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if taskStatus != "new" {
+		return fmt.Errorf("%w: failed to add images to task: task status does not allow adding images", tools.ErrConflict)
+	}
+
+	if limits.MaxTaskImages > 0 || limits.QuotaBytes > 0 {
+		if limits.QuotaBytes > 0 {
+			// images of the owner tasks are registered one upload at a time, so uploads can not exceed the quota together
+			if _, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('storage_quota:' || $1))`, owner); err != nil {
+				return err
+			}
+		}
+
+		usage := task_model.UploadUsage{}
+		if err = tx.Get(&usage, uploadUsageQuery, taskId); err != nil {
+			return err
+		}
+
+		if err = usage.Add(images...).CheckLimits(limits); err != nil {
+			return err
+		}
+	}
+
+	query = `INSERT INTO task_image 
+				(
+				task_id, 
+				image_name, 
+				original_key, 
+				rendition_key, 
+				image_format, 
+				checksum, 
+				size_bytes, 
+				orientation, 
+				width, 
+				height, 
+				dhash
+				) 
+			VALUES (:task_id, :image_name, :original_key, :rendition_key, :image_format, :checksum, :size_bytes, :orientation, :width, :height, :dhash)`
+
+	if _, err = tx.NamedExec(query, images); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DecodeFile decodes the image file data and returns the decoded image with its format,
+// detected by the content; returns imaging.ErrUnsupportedFormat if the format is not supported.
+func (r *TaskRepo) DecodeFile(data []byte) (img image.Image, format string, err error) {
+
+	img, format, err = imaging.Decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, format, err
 }
 
 // ConfirmTaskStatus checks whether task has a specified task status.
@@ -285,7 +623,7 @@ func (r *TaskRepo) ConfirmTaskStatus(taskId int, status string) (ok bool) {
 	var taskStatus string
 
 	query := `SELECT 
-				task_status, 
+				task_status 
 			FROM task 
 			WHERE id=$1`
 
@@ -304,7 +642,8 @@ func (r *TaskRepo) UpdateTaskStatus(taskId int, status string) (err error) {
 	var rowsAffected int64
 
 	query := `UPDATE task 
-				SET task_status=$1 
+				SET task_status=$1, 
+				    status_reason='' 
 				WHERE id=$2`
 
 	result, err = r.db.Exec(query, status, taskId)
@@ -324,122 +663,143 @@ func (r *TaskRepo) UpdateTaskStatus(taskId int, status string) (err error) {
 	return err
 }
 
-// GetFaceDetectionData requests Face Cloud API to detect faces on the specified image and returns response or error.
-func (r *TaskRepo) GetFaceDetectionData(image *task_model.Image, token string) (imageData *face_cloud_model.FaceCloudDetectResponse, err error) {
+// SetTaskError sets the status of a task being processed to "error" and saves the reason of the failure.
+// It returns tools.ErrNotFound if the task is no longer "in_progress", e.g. it was cancelled meanwhile.
+func (r *TaskRepo) SetTaskError(taskId int, reason string) (err error) {
+	var result sql.Result
+	var rowsAffected int64
 
-	// prepare image
-	imagePath := r.getImagePath(image)
-	file, err := os.Open(imagePath)
+	query := `UPDATE task 
+				SET task_status='error', 
+				    status_reason=$1 
+				WHERE id=$2 
+				  AND task_status='in_progress'`
+
+	result, err = r.db.Exec(query, reason, taskId)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
 
-	// send request
-	data, err := face_cloud_client.DetectFaces(file, token)
+	rowsAffected, err = result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// process response data
-	if err = json.Unmarshal(data, &imageData); err != nil {
-		return nil, err
+	if rowsAffected == 0 {
+		return tools.ErrNotFound
 	}
 
-	return imageData, err
+	return err
 }
 
-// GetFaceCloudToken requests login to Face Cloud and returns JWT access token or error.
-func (r *TaskRepo) GetFaceCloudToken() (token string, err error) {
+// GetFaceDetectionData requests the face detector to detect faces on the specified image and returns result or error.
+func (r *TaskRepo) GetFaceDetectionData(ctx context.Context, image *task_model.Image) (result *detector_model.DetectResult, err error) {
 
-	// prepare request params
-	tools.CheckEnvs(faceCloudApiUrlEnvName, faceCloudUserEnvName, faceCloudPasswordEnvName)
-	reqBody := face_cloud_model.FaceCloudLoginRequest{
-		Email:    os.Getenv(faceCloudUserEnvName),
-		Password: os.Getenv(faceCloudPasswordEnvName),
-	}
-
-	reqBodyBytes, err := json.Marshal(reqBody)
+	// prepare image
+	file, size, err := r.store.Get(ctx, image.RenditionKey)
 	if err != nil {
-		return token, err
+		return nil, err
 	}
+	defer file.Close()
 
-	// send request
-	data, err := face_cloud_client.Login(reqBodyBytes)
-	if err != nil {
-		return token, err
-	}
+	return r.detector.Detect(ctx, file, size)
+}
 
-	var response face_cloud_model.FaceCloudLoginResponse
+// SaveProcessedData saves processed face data and marks images as "done" in the database in a single transaction.
+// Errors of previous attempts are cleared.
+func (r *TaskRepo) SaveProcessedData(processedFaces []*task_model.Face, processedImages []*task_model.Image) (err error) {
 
-	// process response data
-	if err = json.Unmarshal(data, &response); err != nil {
-		return token, err
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
 	}
-
-	return response.Data.AccessToken, err
-}
-
-// SaveProcessedData saves processed face data and marks images as "done" in the database.
-func (r *TaskRepo) SaveProcessedData(processedFaces []*task_model.Face, processedImages []*task_model.Image) {
-	var err error
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
 	if len(processedFaces) > 0 {
-		query := `INSERT INTO face 
-						(
-						image_id, 
-						gender, 
-						age, 
-						bbox_height, 
-						bbox_width, 
-						bbox_x, 
-						bbox_y
-						) 
-					VALUES 
-						(
-						:image_id, 
-						:gender, 
-						:age, 
-						:bbox_height, 
-						:bbox_width, 
-						:bbox_x, 
-						:bbox_y
-					)`
-
-		_, err = r.db.NamedExec(query, processedFaces)
+		query := insertFaceQuery
+
+		_, err = tx.NamedExec(query, processedFaces)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 
 	if len(processedImages) > 0 {
 		for _, image := range processedImages {
 			query := `UPDATE task_image 
-					SET done=true 
+					SET image_status='done', 
+					    error='', 
+					    attempts=attempts+1 
 					WHERE id=($1)`
 
-			_, err = r.db.Exec(query, image.Id)
+			_, err = tx.Exec(query, image.Id)
 			if err != nil {
-				panic(err)
+				return err
 			}
 		}
 	}
+
+	return tx.Commit()
 }
 
-// UpdateTaskStatistics updates the statistics for a task, including gender and age data.
+// SetImageError marks the image as "failed" with the given reason and counts the attempt.
+func (r *TaskRepo) SetImageError(imageId int, reason string) (err error) {
+	var result sql.Result
+	var rowsAffected int64
+
+	query := `UPDATE task_image 
+				SET image_status='failed', 
+				    error=$2, 
+				    attempts=attempts+1 
+				WHERE id=$1`
+
+	result, err = r.db.Exec(query, imageId, reason)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return tools.ErrNotFound
+	}
+
+	return err
+}
+
+// UpdateTaskStatistics updates the statistics for a task, including gender and age data, whatever its status is.
 func (r *TaskRepo) UpdateTaskStatistics(task *task_model.Task) (err error) {
+	return r.updateTaskStatistics(task, "")
+}
+
+// FinishTask saves the statistics and the final status of a task being processed.
+// It returns tools.ErrNotFound if the task is no longer "in_progress", e.g. it was cancelled meanwhile.
+func (r *TaskRepo) FinishTask(task *task_model.Task) (err error) {
+	return r.updateTaskStatistics(task, "AND task_status = 'in_progress'")
+}
+
+// updateTaskStatistics updates the statistics and the status of a task matching the condition.
+func (r *TaskRepo) updateTaskStatistics(task *task_model.Task, condition string) (err error) {
 	var result sql.Result
 	var rowsAffected int64
 
 	query := `
 		UPDATE task 
 		SET task_status = :task_status, 
+		    status_reason = :status_reason, 
 		    faces_total = :faces_total, 
 		    faces_male = :faces_male, 
 		    faces_female = :faces_female, 
 		    age_female_avg = :age_female_avg, 
 		    age_male_avg = :age_male_avg 
-		WHERE id = :id`
+		WHERE id = :id ` + condition
 
 	result, err = r.db.NamedExec(query, task)
 	if err != nil {
@@ -3,12 +3,14 @@ package task_repo_test
 import (
 	"database/sql"
 	"errors"
+	"face-track/internal/pkg/detector/fake_detector"
 	"face-track/internal/pkg/model/task_model"
 	"face-track/internal/pkg/repo/task_repo"
 	"face-track/tools"
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -36,11 +38,14 @@ func Test_TaskRepo_CreateTask(t *testing.T) {
 							faces_female, 
 							faces_male, 
 							age_female_avg, 
-							age_male_avg
+							age_male_avg, 
+							callback_url, 
+							exclude_duplicates, 
+							owner
 							) 
-						VALUES ('new', 0, 0, 0, 0, 0) 
+						VALUES ('new', 0, 0, 0, 0, 0, $1, $2, $3) 
 						RETURNING id`,
-					)).WithoutArgs().
+					)).WithArgs("http://example.com/hook", true, "admin").
 					WillReturnError(errors.New("whoops, error")) // Mock DB failure
 			},
 			wantErr: true, // We expect an error here
@@ -58,11 +63,14 @@ func Test_TaskRepo_CreateTask(t *testing.T) {
 							faces_female, 
 							faces_male, 
 							age_female_avg, 
-							age_male_avg
+							age_male_avg, 
+							callback_url, 
+							exclude_duplicates, 
+							owner
 							) 
-						VALUES ('new', 0, 0, 0, 0, 0) 
+						VALUES ('new', 0, 0, 0, 0, 0, $1, $2, $3) 
 						RETURNING id`,
-					)).WithoutArgs().
+					)).WithArgs("http://example.com/hook", true, "admin").
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1)) // Simulate return row
 			},
 			want: 1, // We expect the returned task ID to be 1
@@ -80,7 +88,7 @@ func Test_TaskRepo_CreateTask(t *testing.T) {
 			db := sqlx.NewDb(mockDB, "sqlmock")
 
 			// Initialize the repo with the mocked DB
-			r := task_repo.New(db)
+			r := task_repo.New(db, nil, nil)
 
 			// Set up test-specific expectations
 			if tt.beforeTest != nil {
@@ -88,7 +96,11 @@ func Test_TaskRepo_CreateTask(t *testing.T) {
 			}
 
 			// Call the function under test
-			got, err := r.CreateTask()
+			got, err := r.CreateTask(&task_model.CreateTaskRequest{
+				CallbackUrl:       "http://example.com/hook",
+				ExcludeDuplicates: true,
+				Owner:             "admin",
+			})
 
 			// Check if the error matches expected outcome
 			if (err != nil) != tt.wantErr {
@@ -128,11 +140,16 @@ func Test_TaskRepo_GetTaskById(t *testing.T) {
 						`SELECT 
 							id, 
 							task_status, 
+							status_reason, 
 							faces_total, 
 							faces_female, 
 							faces_male, 
 							age_female_avg, 
-							age_male_avg 
+							age_male_avg, 
+							callback_url, 
+							exclude_duplicates, 
+							created_at, 
+							updated_at 
 						FROM task 
 						WHERE id=$1`,
 					)).WithArgs(1).
@@ -151,11 +168,16 @@ func Test_TaskRepo_GetTaskById(t *testing.T) {
 						`SELECT 
 							id, 
 							task_status, 
+							status_reason, 
 							faces_total, 
 							faces_female, 
 							faces_male, 
 							age_female_avg, 
-							age_male_avg 
+							age_male_avg, 
+							callback_url, 
+							exclude_duplicates, 
+							created_at, 
+							updated_at 
 						FROM task 
 						WHERE id=$1`,
 					)).WithArgs(1).
@@ -173,15 +195,21 @@ func Test_TaskRepo_GetTaskById(t *testing.T) {
 						`SELECT 
 							id, 
 							task_status, 
+							status_reason, 
 							faces_total, 
 							faces_female, 
 							faces_male, 
 							age_female_avg, 
-							age_male_avg 
+							age_male_avg, 
+							callback_url, 
+							exclude_duplicates, 
+							created_at, 
+							updated_at 
 						FROM task 
 						WHERE id=$1`,
 					)).WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "task_status", "faces_total", "faces_female", "faces_male", "age_female_avg", "age_male_avg"}).AddRow(1, "", 0, 0, 0, 0, 0))
+					WillReturnRows(sqlmock.NewRows([]string{"id", "task_status", "status_reason", "faces_total", "faces_female", "faces_male", "age_female_avg", "age_male_avg", "callback_url", "exclude_duplicates", "created_at", "updated_at"}).
+						AddRow(1, "", "", 0, 0, 0, 0, 0, "", false, time.Time{}, time.Time{}))
 			},
 			want:    &task_model.Task{Id: 1},
 			wantErr: false,
@@ -196,7 +224,7 @@ func Test_TaskRepo_GetTaskById(t *testing.T) {
 
 			db := sqlx.NewDb(mockDB, "sqlmock")
 
-			r := task_repo.New(db)
+			r := task_repo.New(db, nil, nil)
 
 			if tt.beforeTest != nil {
 				tt.beforeTest(mockSQL)
@@ -248,7 +276,18 @@ func Test_TaskRepo_GetTaskImages(t *testing.T) {
 							id, 
 							task_id, 
 							image_name, 
-							done 
+							original_key, 
+							rendition_key, 
+							image_format, 
+							checksum, 
+							size_bytes, 
+							orientation, 
+							width, 
+							height, 
+							dhash, 
+							image_status, 
+							error, 
+							attempts 
 						FROM task_image 
 						WHERE task_id=$1`,
 					)).WithArgs(1).
@@ -267,13 +306,41 @@ func Test_TaskRepo_GetTaskImages(t *testing.T) {
 							id, 
 							task_id, 
 							image_name, 
-							done 
+							original_key, 
+							rendition_key, 
+							image_format, 
+							checksum, 
+							size_bytes, 
+							orientation, 
+							width, 
+							height, 
+							dhash, 
+							image_status, 
+							error, 
+							attempts 
 						FROM task_image 
 						WHERE task_id=$1`,
 					)).WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "image_name", "done"}).AddRow(2, 1, "", false))
+					WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "image_name", "original_key", "rendition_key", "image_format", "checksum", "size_bytes", "orientation", "width", "height", "dhash", "image_status", "error", "attempts"}).
+						AddRow(2, 1, "a.png", "blobs/ab/abc.png", "blobs/ab/abc.jpg", "png", "abc", 10, 6, 30, 40, "00ff00ff00ff00ff", "failed", "bad image", 1))
 			},
-			want:    []*task_model.Image{{Id: 2, TaskId: 1}},
+			want: []*task_model.Image{{
+				Id:           2,
+				TaskId:       1,
+				ImageName:    "a.png",
+				OriginalKey:  "blobs/ab/abc.png",
+				RenditionKey: "blobs/ab/abc.jpg",
+				Format:       "png",
+				Checksum:     "abc",
+				Size:         10,
+				Orientation:  6,
+				Width:        30,
+				Height:       40,
+				DHash:        "00ff00ff00ff00ff",
+				Status:       "failed",
+				Error:        "bad image",
+				Attempts:     1,
+			}},
 			wantErr: false,
 		},
 	}
@@ -286,7 +353,7 @@ func Test_TaskRepo_GetTaskImages(t *testing.T) {
 
 			db := sqlx.NewDb(mockDB, "sqlmock")
 
-			r := task_repo.New(db)
+			r := task_repo.New(db, nil, nil)
 
 			if tt.beforeTest != nil {
 				tt.beforeTest(mockSQL)
@@ -306,6 +373,99 @@ func Test_TaskRepo_GetTaskImages(t *testing.T) {
 	}
 }
 
+func Test_TaskRepo_GetTaskImage(t *testing.T) {
+
+	query := regexp.QuoteMeta(`SELECT 
+				id, 
+				task_id, 
+				image_name, 
+				original_key, 
+				rendition_key, 
+				image_format, 
+				checksum, 
+				size_bytes, 
+				orientation, 
+				width, 
+				height, 
+				dhash, 
+				image_status, 
+				error, 
+				attempts 
+			FROM task_image 
+			WHERE task_id=$1 AND image_name=$2`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		want          *task_model.Image
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // no image with the name
+			name: "fail retrieve image: not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(query).WithArgs(1, "a.png").WillReturnError(sql.ErrNoRows)
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success retrieve image
+			name: "success retrieving task image",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(query).WithArgs(1, "a.png").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "image_name", "original_key", "rendition_key", "image_format", "checksum", "size_bytes", "orientation", "width", "height", "dhash", "image_status", "error", "attempts"}).
+						AddRow(2, 1, "a.png", "blobs/ab/abc.png", "blobs/ab/abc.jpg", "png", "abc", 10, 6, 30, 40, "00ff00ff00ff00ff", "done", "", 1))
+			},
+			want: &task_model.Image{
+				Id:           2,
+				TaskId:       1,
+				ImageName:    "a.png",
+				OriginalKey:  "blobs/ab/abc.png",
+				RenditionKey: "blobs/ab/abc.jpg",
+				Format:       "png",
+				Checksum:     "abc",
+				Size:         10,
+				Orientation:  6,
+				Width:        30,
+				Height:       40,
+				DHash:        "00ff00ff00ff00ff",
+				Status:       "done",
+				Attempts:     1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			got, err := r.GetTaskImage(1, "a.png")
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.GetTaskImage() error = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("taskRepo.GetTaskImage() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("taskRepo.GetTaskImage() = %v, want = %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_TaskRepo_GetFacesByImageIds(t *testing.T) {
 
 	type args struct {
@@ -332,7 +492,24 @@ func Test_TaskRepo_GetFacesByImageIds(t *testing.T) {
 						bbox_height, 
 						bbox_width, 
 						bbox_x, 
-						bbox_y 
+						bbox_y, 
+						age_variance, 
+						ethnicity, 
+						score, 
+						liveness, 
+						facial_hair, 
+						glasses, 
+						hair_color, 
+						hair_type, 
+						headwear, 
+						landmarks, 
+						mask_full_face, 
+						mask_lower_face, 
+						mask_none, 
+						mask_other, 
+						quality_blurriness, 
+						quality_overexposure, 
+						quality_underexposure 
 					FROM face 
 					WHERE image_id IN (?)`,
 				)).WithArgs([]int{}).
@@ -353,11 +530,40 @@ func Test_TaskRepo_GetFacesByImageIds(t *testing.T) {
 						bbox_height, 
 						bbox_width, 
 						bbox_x, 
-						bbox_y 
+						bbox_y, 
+						age_variance, 
+						ethnicity, 
+						score, 
+						liveness, 
+						facial_hair, 
+						glasses, 
+						hair_color, 
+						hair_type, 
+						headwear, 
+						landmarks, 
+						mask_full_face, 
+						mask_lower_face, 
+						mask_none, 
+						mask_other, 
+						quality_blurriness, 
+						quality_overexposure, 
+						quality_underexposure 
 					FROM face 
 					WHERE image_id IN (?, ?, ?)`,
 				)).WithArgs(3, 4, 5).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "image_id", "gender", "age", "bbox_height", "bbox_width", "bbox_x", "bbox_y"}).AddRow(2, 3, "male", 34, 700, 600, 1088, 904))
+					WillReturnRows(sqlmock.NewRows([]string{
+						"id", "image_id", "gender", "age", "bbox_height", "bbox_width", "bbox_x", "bbox_y",
+						"age_variance", "ethnicity", "score", "liveness",
+						"facial_hair", "glasses", "hair_color", "hair_type", "headwear", "landmarks",
+						"mask_full_face", "mask_lower_face", "mask_none", "mask_other",
+						"quality_blurriness", "quality_overexposure", "quality_underexposure",
+					}).AddRow(
+						2, 3, "male", 34, 700, 600, 1088, 904,
+						2.5, "white", 0.98, 1,
+						"none", "present", "brown", "straight", "none", []byte(`[{"x":10,"y":20}]`),
+						0, 0, 1, 0,
+						10, 20, 30,
+					))
 			},
 			want:    map[int][]*task_model.Face{3: {&task_model.Face{Id: 2, ImageId: 3}}},
 			wantErr: false,
@@ -371,7 +577,7 @@ func Test_TaskRepo_GetFacesByImageIds(t *testing.T) {
 
 			db := sqlx.NewDb(mockDB, "sqlmock")
 
-			r := task_repo.New(db)
+			r := task_repo.New(db, nil, nil)
 
 			if tt.beforeTest != nil {
 				tt.beforeTest(mockSQL)
@@ -474,7 +680,7 @@ func Test_TaskRepo_DeleteTask(t *testing.T) {
 
 			db := sqlx.NewDb(mockDB, "sqlmock")
 
-			r := task_repo.New(db)
+			r := task_repo.New(db, nil, nil)
 
 			if tt.beforeTest != nil {
 				tt.beforeTest(mockSQL)
@@ -516,7 +722,7 @@ func Test_TaskRepo_CreateImage(t *testing.T) {
 				Id:        1,
 				TaskId:    2,
 				ImageName: "Sample Image Name",
-				DoneFlag:  false,
+				Status:    "pending",
 			}},
 			beforeTest: func(mockSQL sqlmock.Sqlmock) {
 				mockSQL.ExpectExec(regexp.QuoteMeta(
@@ -537,7 +743,7 @@ func Test_TaskRepo_CreateImage(t *testing.T) {
 				Id:        1,
 				TaskId:    2,
 				ImageName: "Sample Image Name",
-				DoneFlag:  false,
+				Status:    "pending",
 			}},
 			beforeTest: func(mockSQL sqlmock.Sqlmock) {
 				mockSQL.ExpectExec(regexp.QuoteMeta(
@@ -563,7 +769,7 @@ func Test_TaskRepo_CreateImage(t *testing.T) {
 
 			db := sqlx.NewDb(mockDB, "sqlmock")
 
-			r := task_repo.New(db)
+			r := task_repo.New(db, nil, nil)
 
 			if tt.beforeTest != nil {
 				tt.beforeTest(mockSQL)
@@ -579,3 +785,479 @@ func Test_TaskRepo_CreateImage(t *testing.T) {
 		})
 	}
 }
+
+func Test_TaskRepo_ReplaceImageFaces(t *testing.T) {
+
+	type args struct {
+		imageIds []int
+		faces    []*task_model.Face
+	}
+
+	tests := []struct {
+		name       string
+		args       args
+		beforeTest func(sqlmock.Sqlmock)
+		wantErr    bool
+	}{
+		{ // failed delete rolls back the transaction
+			name: "fail delete old faces",
+			args: args{imageIds: []int{1, 2}},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectExec(regexp.QuoteMeta(
+					`DELETE FROM face WHERE image_id IN (?, ?)`,
+				)).WithArgs(1, 2).
+					WillReturnError(errors.New("db error"))
+				mockSQL.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{ // success replacing faces
+			name: "success replace faces",
+			args: args{imageIds: []int{1}, faces: []*task_model.Face{{ImageId: 1, Gender: "male", Age: 30}}},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectExec(regexp.QuoteMeta(
+					`DELETE FROM face WHERE image_id IN (?)`,
+				)).WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mockSQL.ExpectExec(`INSERT INTO face`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mockSQL.ExpectExec(regexp.QuoteMeta(
+					`UPDATE task_image SET image_status='done', error='' WHERE id IN (?)`,
+				)).WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectCommit()
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.ReplaceImageFaces(tt.args.imageIds, tt.args.faces)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.ReplaceImageFaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_TaskRepo_SetImageError(t *testing.T) {
+
+	query := regexp.QuoteMeta(`UPDATE task_image 
+				SET image_status='failed', 
+				    error=$2, 
+				    attempts=attempts+1 
+				WHERE id=$1`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // image with given id not found
+			name: "fail set image error: image not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs(1, "bad image").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success marking image as failed
+			name: "success set image error",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs(1, "bad image").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.SetImageError(1, "bad image")
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.SetImageError() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("taskRepo.SetImageError() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_TaskRepo_FinishTask(t *testing.T) {
+
+	query := regexp.QuoteMeta(`
+		UPDATE task 
+		SET task_status = ?, 
+		    status_reason = ?, 
+		    faces_total = ?, 
+		    faces_male = ?, 
+		    faces_female = ?, 
+		    age_female_avg = ?, 
+		    age_male_avg = ? 
+		WHERE id = ? AND task_status = 'in_progress'`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // the task was cancelled while it was processed, its status is not overwritten
+			name: "fail finish task: task was cancelled",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs("completed", "", 3, 2, 1, 30, 40, 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success saving the result of the task in progress
+			name: "success finish task",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs("completed", "", 3, 2, 1, 30, 40, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.FinishTask(&task_model.Task{
+				Id:           1,
+				Status:       "completed",
+				FacesTotal:   3,
+				FacesMale:    2,
+				FacesFemale:  1,
+				AgeFemaleAvg: 30,
+				AgeMaleAvg:   40,
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.FinishTask() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("taskRepo.FinishTask() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_TaskRepo_SetTaskError(t *testing.T) {
+
+	query := regexp.QuoteMeta(`UPDATE task 
+				SET task_status='error', 
+				    status_reason=$1 
+				WHERE id=$2 
+				  AND task_status='in_progress'`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // the task was cancelled while it was processed, its status is not overwritten
+			name: "fail set task error: task was cancelled",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs("provider unavailable", 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success marking the task in progress as failed
+			name: "success set task error",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs("provider unavailable", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.SetTaskError(1, "provider unavailable")
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.SetTaskError() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("taskRepo.SetTaskError() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_TaskRepo_CreateImages(t *testing.T) {
+
+	selectQuery := regexp.QuoteMeta(`SELECT task_status, owner FROM task WHERE id=$1 FOR UPDATE`)
+	lockQuery := regexp.QuoteMeta(`SELECT pg_advisory_xact_lock(hashtext('storage_quota:' || $1))`)
+	usageQuery := regexp.QuoteMeta(`SELECT 
+				(SELECT COUNT(*) FROM task_image WHERE task_id=t.id) AS task_images, 
+				COALESCE((
+					SELECT SUM(i.size_bytes) 
+					FROM task_image i 
+					JOIN task o ON o.id = i.task_id 
+					WHERE o.owner = t.owner
+				), 0) AS owner_bytes 
+			FROM task t 
+			WHERE t.id=$1`)
+
+	images := []*task_model.Image{
+		{TaskId: 1, ImageName: "first.jpg", OriginalKey: "blobs/ab/abc.jpg", RenditionKey: "blobs/ab/abc.jpg", Format: "jpeg", Checksum: "abc", Size: 10, Orientation: 1, Width: 3, Height: 4, DHash: "0000000000000001"},
+		{TaskId: 1, ImageName: "second.png", OriginalKey: "blobs/de/def.png", RenditionKey: "blobs/de/def.jpg", Format: "png", Checksum: "def", Size: 20, Orientation: 1, Width: 5, Height: 6, DHash: "0000000000000002"},
+	}
+
+	tests := []struct {
+		name          string
+		limits        task_model.UploadLimits
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // task with given id not found
+			name: "fail create images: task not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // task is already processed
+			name: "fail create images: task status does not allow adding images",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status", "owner"}).AddRow("in_progress", "admin"))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrConflict,
+		},
+		{ // success creating all image rows
+			name: "success create images",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status", "owner"}).AddRow("new", "admin"))
+				mockSQL.ExpectExec(`INSERT INTO task_image`).
+					WithArgs(1, "first.jpg", "blobs/ab/abc.jpg", "blobs/ab/abc.jpg", "jpeg", "abc", 10, 1, 3, 4, "0000000000000001", 1, "second.png", "blobs/de/def.png", "blobs/de/def.jpg", "png", "def", 20, 1, 5, 6, "0000000000000002").
+					WillReturnResult(sqlmock.NewResult(2, 2))
+				mockSQL.ExpectCommit()
+			},
+		},
+		{ // the task would have too many images
+			name:   "fail create images: too many task images",
+			limits: task_model.UploadLimits{MaxTaskImages: 3},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status", "owner"}).AddRow("new", "admin"))
+				mockSQL.ExpectQuery(usageQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_images", "owner_bytes"}).AddRow(2, 100))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrUnprocessable,
+		},
+		{ // the files would exceed the quota of the task owner
+			name:   "fail create images: quota exceeded",
+			limits: task_model.UploadLimits{QuotaBytes: 120},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status", "owner"}).AddRow("new", "admin"))
+				mockSQL.ExpectExec(lockQuery).WithArgs("admin").WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectQuery(usageQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_images", "owner_bytes"}).AddRow(2, 100))
+				mockSQL.ExpectRollback()
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrTooLarge,
+		},
+		{ // the images fit the limits
+			name:   "success create images within limits",
+			limits: task_model.UploadLimits{MaxTaskImages: 4, QuotaBytes: 130},
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectBegin()
+				mockSQL.ExpectQuery(selectQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_status", "owner"}).AddRow("new", "admin"))
+				mockSQL.ExpectExec(lockQuery).WithArgs("admin").WillReturnResult(sqlmock.NewResult(0, 1))
+				mockSQL.ExpectQuery(usageQuery).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"task_images", "owner_bytes"}).AddRow(2, 100))
+				mockSQL.ExpectExec(`INSERT INTO task_image`).WillReturnResult(sqlmock.NewResult(2, 2))
+				mockSQL.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, nil, nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.CreateImages(1, images, tt.limits)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.CreateImages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("taskRepo.CreateImages() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_TaskRepo_GetCachedDetection(t *testing.T) {
+
+	selectQuery := regexp.QuoteMeta(`SELECT response FROM detection_cache WHERE checksum=$1 AND provider=$2`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantFaces     int
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // the content was not analyzed by the detector
+			name: "fail get cached detection: not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(selectQuery).WithArgs("abc", fake_detector.Name).WillReturnError(sql.ErrNoRows)
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // the cached response is parsed by the detector
+			name: "success get cached detection",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(selectQuery).WithArgs("abc", fake_detector.Name).
+					WillReturnRows(sqlmock.NewRows([]string{"response"}).
+						AddRow(`{"faces":[{"gender":"male","age":30}],"rotation":0}`))
+			},
+			wantFaces: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := task_repo.New(db, fake_detector.New(1), nil)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			result, err := r.GetCachedDetection("abc")
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("taskRepo.GetCachedDetection() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("taskRepo.GetCachedDetection() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err == nil && len(result.Faces) != tt.wantFaces {
+				t.Errorf("taskRepo.GetCachedDetection() = %d faces, want %d", len(result.Faces), tt.wantFaces)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package webhook_repo provides methods for managing webhook deliveries in the database.
+package webhook_repo
+
+import (
+	"database/sql"
+	"errors"
+	"face-track/internal/pkg/model/webhook_model"
+	"face-track/tools"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WebhookRepo represents a repository for queueing webhook deliveries and logging their outcome.
+type WebhookRepo struct {
+	db *sqlx.DB
+}
+
+// New creates a new WebhookRepo instance with the provided database connection.
+func New(db *sqlx.DB) (repo *WebhookRepo) {
+	return &WebhookRepo{
+		db: db,
+	}
+}
+
+// CreateDelivery queues the webhook delivery.
+func (r *WebhookRepo) CreateDelivery(delivery *webhook_model.Delivery) (err error) {
+
+	query := `INSERT INTO webhook_delivery 
+				(
+				task_id, 
+				url, 
+				payload
+				) 
+			VALUES ($1, $2, $3) 
+			RETURNING id`
+
+	return r.db.QueryRow(query, delivery.TaskId, delivery.Url, delivery.Payload).Scan(&delivery.Id)
+}
+
+// ClaimDelivery takes the oldest due pending delivery and counts the attempt; returns tools.ErrNotFound
+// if nothing is due. The delivery is not due again for the lease duration, so one abandoned
+// by a dead worker is retried afterwards.
+func (r *WebhookRepo) ClaimDelivery(lease time.Duration) (delivery *webhook_model.Delivery, err error) {
+	delivery = &webhook_model.Delivery{}
+
+	query := `UPDATE webhook_delivery 
+				SET attempts=attempts+1, 
+				    next_attempt_at=now() + make_interval(secs => $1), 
+				    updated_at=now() 
+				WHERE id = (
+					SELECT id 
+					FROM webhook_delivery 
+					WHERE delivery_status='pending' AND next_attempt_at <= now() 
+					ORDER BY next_attempt_at, id 
+					LIMIT 1 
+					FOR UPDATE SKIP LOCKED
+				) 
+				RETURNING id, task_id, url, payload, delivery_status, attempts, response_code, last_error`
+
+	err = r.db.QueryRowx(query, lease.Seconds()).StructScan(delivery)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, err
+}
+
+// CompleteDelivery marks the delivery as delivered with the response code of the callback.
+func (r *WebhookRepo) CompleteDelivery(deliveryId int, responseCode int) (err error) {
+
+	query := `UPDATE webhook_delivery 
+				SET delivery_status='delivered', 
+				    response_code=$2, 
+				    last_error='', 
+				    delivered_at=now(), 
+				    updated_at=now() 
+				WHERE id=$1`
+
+	return r.execDeliveryUpdate(query, deliveryId, responseCode)
+}
+
+// RetryDelivery records the failed attempt and schedules the next one after the delay.
+func (r *WebhookRepo) RetryDelivery(deliveryId int, responseCode int, reason string, delay time.Duration) (err error) {
+
+	query := `UPDATE webhook_delivery 
+				SET response_code=$2, 
+				    last_error=$3, 
+				    next_attempt_at=now() + make_interval(secs => $4), 
+				    updated_at=now() 
+				WHERE id=$1`
+
+	return r.execDeliveryUpdate(query, deliveryId, responseCode, reason, delay.Seconds())
+}
+
+// FailDelivery records the failed attempt and gives up the delivery.
+func (r *WebhookRepo) FailDelivery(deliveryId int, responseCode int, reason string) (err error) {
+
+	query := `UPDATE webhook_delivery 
+				SET delivery_status='failed', 
+				    response_code=$2, 
+				    last_error=$3, 
+				    updated_at=now() 
+				WHERE id=$1`
+
+	return r.execDeliveryUpdate(query, deliveryId, responseCode, reason)
+}
+
+// execDeliveryUpdate runs the update query and returns tools.ErrNotFound if no delivery was updated.
+func (r *WebhookRepo) execDeliveryUpdate(query string, args ...interface{}) (err error) {
+	var result sql.Result
+	var rowsAffected int64
+
+	result, err = r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return tools.ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,167 @@
+package webhook_repo_test
+
+import (
+	"database/sql"
+	"errors"
+	"face-track/internal/pkg/model/task_model"
+	"face-track/internal/pkg/model/webhook_model"
+	"face-track/internal/pkg/repo/webhook_repo"
+	"face-track/tools"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_WebhookRepo_ClaimDelivery(t *testing.T) {
+
+	claimQuery := regexp.QuoteMeta(`UPDATE webhook_delivery 
+				SET attempts=attempts+1, 
+				    next_attempt_at=now() + make_interval(secs => $1), 
+				    updated_at=now() 
+				WHERE id = (
+					SELECT id 
+					FROM webhook_delivery 
+					WHERE delivery_status='pending' AND next_attempt_at <= now() 
+					ORDER BY next_attempt_at, id 
+					LIMIT 1 
+					FOR UPDATE SKIP LOCKED
+				) 
+				RETURNING id, task_id, url, payload, delivery_status, attempts, response_code, last_error`)
+
+	columns := []string{"id", "task_id", "url", "payload", "delivery_status", "attempts", "response_code", "last_error"}
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		want          *webhook_model.Delivery
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // no due deliveries
+			name: "fail claim delivery: nothing is due",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(claimQuery).WithArgs(float64(20)).
+					WillReturnError(sql.ErrNoRows)
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success claiming delivery
+			name: "success claim delivery",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectQuery(claimQuery).WithArgs(float64(20)).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow(4, 7, "http://example.com/hook", []byte(`{"taskId":7}`), "pending", 2, 503, "callback responded with status 503"))
+			},
+			want: &webhook_model.Delivery{
+				Id:           4,
+				TaskId:       7,
+				Url:          "http://example.com/hook",
+				Payload:      task_model.RawJSON(`{"taskId":7}`),
+				Status:       "pending",
+				Attempts:     2,
+				ResponseCode: 503,
+				LastError:    "callback responded with status 503",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := webhook_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			got, err := r.ClaimDelivery(20 * time.Second)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("webhookRepo.ClaimDelivery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("webhookRepo.ClaimDelivery() error type = %v, want err type %v", err, tt.wantErrorType)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("webhookRepo.ClaimDelivery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_WebhookRepo_RetryDelivery(t *testing.T) {
+
+	query := regexp.QuoteMeta(`UPDATE webhook_delivery 
+				SET response_code=$2, 
+				    last_error=$3, 
+				    next_attempt_at=now() + make_interval(secs => $4), 
+				    updated_at=now() 
+				WHERE id=$1`)
+
+	tests := []struct {
+		name          string
+		beforeTest    func(sqlmock.Sqlmock)
+		wantErr       bool
+		wantErrorType error
+	}{
+		{ // delivery with given id not found
+			name: "fail retry delivery: delivery not found",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs(4, 503, "unavailable", float64(10)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr:       true,
+			wantErrorType: tools.ErrNotFound,
+		},
+		{ // success scheduling the next attempt
+			name: "success retry delivery",
+			beforeTest: func(mockSQL sqlmock.Sqlmock) {
+				mockSQL.ExpectExec(query).WithArgs(4, 503, "unavailable", float64(10)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mockSQL, _ := sqlmock.New()
+			defer mockDB.Close()
+
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			r := webhook_repo.New(db)
+
+			if tt.beforeTest != nil {
+				tt.beforeTest(mockSQL)
+			}
+
+			err := r.RetryDelivery(4, 503, "unavailable", 10*time.Second)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("webhookRepo.RetryDelivery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrorType != nil && !errors.Is(err, tt.wantErrorType) {
+				t.Errorf("webhookRepo.RetryDelivery() error type = %v, want err type %v", err, tt.wantErrorType)
+			}
+
+			if err := mockSQL.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
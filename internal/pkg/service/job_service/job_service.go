@@ -0,0 +1,337 @@
+// Package job_service provides a worker pool processing jobs from the Postgres-backed job queue.
+package job_service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"face-track/internal/pkg/event_bus"
+	"face-track/internal/pkg/model/event_model"
+	"face-track/internal/pkg/model/job_model"
+	"face-track/internal/pkg/repo"
+	"face-track/tools"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// interruptedReason is the status reason of tasks whose processing was interrupted too many times.
+const interruptedReason = "processing was interrupted"
+
+// Processor runs the work of the jobs.
+type Processor interface {
+	ProcessTask(ctx context.Context, taskId int)
+}
+
+// Notifier notifies external systems about finished tasks.
+type Notifier interface {
+	NotifyTask(taskId int) error
+}
+
+// JobService queues jobs and runs workers executing them.
+// Jobs are stored in the database, so they survive restarts and are shared between app instances.
+// A running job holds a lease on its task renewed by a heartbeat; tasks whose lease has expired
+// were left by a dead worker and are recovered on start and periodically afterwards.
+type JobService struct {
+	repo             *repo.Repo
+	events           *event_bus.EventBus
+	processor        Processor
+	notifier         Notifier
+	workers          int
+	pollInterval     time.Duration
+	lease            time.Duration
+	maxAttempts      int
+	imageMaxAttempts int
+	owner            string
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[int]context.CancelFunc
+}
+
+// New creates a new JobService with the given number of workers polling the queue at the given interval.
+// The lease bounds how long a task stays "in_progress" after its worker died; a job interrupted
+// maxAttempts times is failed instead of being resumed. Failed images are retried
+// until they were tried imageMaxAttempts times. Task status changes are published to the event bus,
+// tasks failed on recovery are reported to the notifier.
+func New(
+	repo *repo.Repo,
+	events *event_bus.EventBus,
+	processor Processor,
+	notifier Notifier,
+	workers int,
+	pollInterval, lease time.Duration,
+	maxAttempts, imageMaxAttempts int,
+) *JobService {
+	if lease < time.Second {
+		lease = time.Second
+	}
+
+	return &JobService{
+		repo:             repo,
+		events:           events,
+		processor:        processor,
+		notifier:         notifier,
+		workers:          workers,
+		pollInterval:     pollInterval,
+		lease:            lease,
+		maxAttempts:      maxAttempts,
+		imageMaxAttempts: imageMaxAttempts,
+		owner:            newOwnerId(),
+		wake:             make(chan struct{}, 1),
+		running:          make(map[int]context.CancelFunc),
+	}
+}
+
+// newOwnerId returns an ID identifying this app instance as the lease owner.
+func newOwnerId() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// EnqueueTask queues the task for processing.
+func (s *JobService) EnqueueTask(taskId int) (err error) {
+
+	if err = s.repo.EnqueueTaskJob(taskId, job_model.KindProcessTask); err != nil {
+		return err
+	}
+
+	s.publishStatus(taskId, "in_progress", "")
+	s.notify()
+
+	return nil
+}
+
+// RetryTask queues processing of the task images whose detection failed; processed images are kept.
+func (s *JobService) RetryTask(taskId int) (err error) {
+
+	if err = s.repo.EnqueueRetryJob(taskId, s.imageMaxAttempts); err != nil {
+		return err
+	}
+
+	s.publishStatus(taskId, "in_progress", "")
+	s.notify()
+
+	return nil
+}
+
+// publishStatus publishes the task status change to the event bus.
+func (s *JobService) publishStatus(taskId int, status, reason string) {
+	s.events.Publish(event_model.NewEvent(event_model.TypeStatus, taskId, event_model.Status{
+		Status: status,
+		Reason: reason,
+	}))
+}
+
+// notify wakes up an idle worker instead of waiting for the next poll.
+func (s *JobService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// CancelTask cancels processing of the task. A job running in this app instance is stopped at once,
+// one running elsewhere is stopped by its heartbeat.
+func (s *JobService) CancelTask(taskId int) (err error) {
+
+	if err = s.repo.CancelTaskJob(taskId); err != nil {
+		return err
+	}
+
+	s.publishStatus(taskId, "cancelled", "cancelled by user")
+
+	s.mu.Lock()
+	cancel, ok := s.running[taskId]
+	s.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+
+	return nil
+}
+
+// StartWorkers recovers tasks left by dead workers and starts the workers;
+// they stop taking new jobs when the context is done.
+func (s *JobService) StartWorkers(ctx context.Context) {
+	s.recover()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.watchLeases(ctx)
+	}()
+
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.work(ctx)
+		}()
+	}
+}
+
+// WaitWorkers blocks until all workers have finished their current jobs and stopped.
+func (s *JobService) WaitWorkers() {
+	s.wg.Wait()
+}
+
+// watchLeases periodically recovers tasks whose lease has expired until the context is done.
+func (s *JobService) watchLeases(ctx context.Context) {
+	ticker := time.NewTicker(s.lease)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.recover()
+		}
+	}
+}
+
+// recover resumes or fails tasks whose worker lease has expired.
+func (s *JobService) recover() {
+	resumed, failed, err := s.repo.RecoverExpiredTasks(s.maxAttempts, interruptedReason)
+	if err != nil {
+		log.Printf("error recovering tasks: %v\n", err)
+		return
+	}
+
+	if len(resumed) > 0 {
+		log.Printf("resumed interrupted tasks: %v\n", resumed)
+		s.notify()
+	}
+	if len(failed) > 0 {
+		log.Printf("failed interrupted tasks: %v\n", failed)
+
+		for _, taskId := range failed {
+			s.publishStatus(taskId, "error", interruptedReason)
+
+			if err := s.notifier.NotifyTask(taskId); err != nil {
+				log.Printf("error notifying about task %d: %v\n", taskId, err)
+			}
+		}
+	}
+}
+
+// work claims and runs jobs until the context is done.
+func (s *JobService) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := s.repo.ClaimJob(s.owner, s.lease)
+		if err == nil {
+			s.runJob(job)
+			continue
+		}
+
+		if !errors.Is(err, tools.ErrNotFound) {
+			log.Printf("error claiming job: %v\n", err)
+		}
+
+		// the queue is empty or unavailable, wait for new jobs
+		timer := time.NewTimer(s.pollInterval)
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// runJob executes the job and records its outcome.
+// A running job is not interrupted on shutdown, so the workers context is not passed to the processor;
+// the job context is cancelled only when the task is cancelled.
+func (s *JobService) runJob(job *job_model.Job) {
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	s.running[job.TaskId] = cancel
+	s.mu.Unlock()
+
+	stop := s.heartbeat(job.TaskId, cancel)
+
+	defer func() {
+		stop()
+		cancel()
+
+		s.mu.Lock()
+		delete(s.running, job.TaskId)
+		s.mu.Unlock()
+
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+
+		// recording the outcome also releases the task lease
+		if err != nil {
+			log.Printf("job %d failed: %v\n", job.Id, err)
+			if err = s.repo.FailJob(job, s.owner, err.Error()); err != nil {
+				log.Printf("error saving job %d result: %v\n", job.Id, err)
+			}
+			return
+		}
+
+		if err = s.repo.CompleteJob(job, s.owner); err != nil {
+			log.Printf("error saving job %d result: %v\n", job.Id, err)
+		}
+	}()
+
+	switch job.Kind {
+	case job_model.KindProcessTask:
+		s.processor.ProcessTask(ctx, job.TaskId)
+	default:
+		err = fmt.Errorf("unknown job kind: %s", job.Kind)
+	}
+}
+
+// heartbeat renews the task lease until the returned function is called;
+// cancels the job if the task was cancelled or taken over by another worker.
+func (s *JobService) heartbeat(taskId int, cancel context.CancelFunc) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(s.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := s.repo.ExtendTaskLease(taskId, s.owner, s.lease)
+				if errors.Is(err, tools.ErrNotFound) {
+					cancel()
+					return
+				}
+				if err != nil {
+					log.Printf("error extending task %d lease: %v\n", taskId, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -4,13 +4,23 @@
 package service
 
 import (
+	"context"
+	"face-track/internal/pkg/archive"
+	"face-track/internal/pkg/blob_store"
 	"face-track/internal/pkg/database"
+	"face-track/internal/pkg/detector"
+	"face-track/internal/pkg/event_bus"
+	"face-track/internal/pkg/model/event_model"
 	"face-track/internal/pkg/model/task_model"
 	"face-track/internal/pkg/repo"
+	"face-track/internal/pkg/service/job_service"
 	"face-track/internal/pkg/service/task_service"
+	"face-track/internal/pkg/service/webhook_service"
 	"face-track/tools"
+	"io"
 	"log"
 	"os"
+	"time"
 )
 
 const (
@@ -22,12 +32,76 @@ const (
 
 	// pgPassEnvName is the env variable key for the PostgreSQL database password.
 	pgPassEnvName = "FACE_TRACK__PG_PASS"
+
+	// workersEnvName is the env variable key for the number of background job workers.
+	workersEnvName = "FACE_TRACK__WORKERS"
+
+	// queuePollIntervalEnvName is the env variable key for how often idle workers poll the job queue.
+	queuePollIntervalEnvName = "FACE_TRACK__QUEUE_POLL_INTERVAL"
+
+	// taskLeaseEnvName is the env variable key for how long a task is leased to its worker without a heartbeat.
+	taskLeaseEnvName = "FACE_TRACK__TASK_LEASE"
+
+	// jobMaxAttemptsEnvName is the env variable key for how many times an interrupted job is resumed.
+	jobMaxAttemptsEnvName = "FACE_TRACK__JOB_MAX_ATTEMPTS"
+
+	// imageMaxAttemptsEnvName is the env variable key for how many times detection of an image is tried.
+	imageMaxAttemptsEnvName = "FACE_TRACK__IMAGE_MAX_ATTEMPTS"
+
+	// webhookUrlEnvName is the env variable key for the callback URL of tasks created without their own one.
+	webhookUrlEnvName = "FACE_TRACK__WEBHOOK_URL"
+
+	// webhookSecretEnvName is the env variable key for the HMAC key signing webhook payloads.
+	webhookSecretEnvName = "FACE_TRACK__WEBHOOK_SECRET"
+
+	// webhookTimeoutEnvName is the env variable key for the timeout of a webhook call.
+	webhookTimeoutEnvName = "FACE_TRACK__WEBHOOK_TIMEOUT"
+
+	// webhookMaxAttemptsEnvName is the env variable key for how many times a webhook delivery is tried.
+	webhookMaxAttemptsEnvName = "FACE_TRACK__WEBHOOK_MAX_ATTEMPTS"
+
+	// webhookRetryDelayEnvName is the env variable key for the delay before the first webhook retry.
+	webhookRetryDelayEnvName = "FACE_TRACK__WEBHOOK_RETRY_DELAY"
+
+	// archiveMaxBytesEnvName is the env variable key for the largest uploaded archive in bytes.
+	archiveMaxBytesEnvName = "FACE_TRACK__ARCHIVE_MAX_BYTES"
+
+	// archiveMaxEntriesEnvName is the env variable key for the largest number of archive entries.
+	archiveMaxEntriesEnvName = "FACE_TRACK__ARCHIVE_MAX_ENTRIES"
+
+	// archiveMaxEntryBytesEnvName is the env variable key for the largest uncompressed archive entry in bytes.
+	archiveMaxEntryBytesEnvName = "FACE_TRACK__ARCHIVE_MAX_ENTRY_BYTES"
+
+	// archiveMaxTotalBytesEnvName is the env variable key for the largest uncompressed archive content in bytes.
+	archiveMaxTotalBytesEnvName = "FACE_TRACK__ARCHIVE_MAX_TOTAL_BYTES"
+
+	// duplicateDistanceEnvName is the env variable key for the largest number of bits perceptual hashes
+	// of near-duplicate images differ in.
+	duplicateDistanceEnvName = "FACE_TRACK__DUPLICATE_DISTANCE"
+
+	// imageMaxBytesEnvName is the env variable key for the largest size of an uploaded image file in bytes.
+	imageMaxBytesEnvName = "FACE_TRACK__IMAGE_MAX_BYTES"
+
+	// imageMaxSideEnvName is the env variable key for the largest width or height of an uploaded image in pixels.
+	imageMaxSideEnvName = "FACE_TRACK__IMAGE_MAX_SIDE"
+
+	// imageMaxPixelsEnvName is the env variable key for the largest number of pixels of an uploaded image.
+	imageMaxPixelsEnvName = "FACE_TRACK__IMAGE_MAX_PIXELS"
+
+	// taskMaxImagesEnvName is the env variable key for the largest number of images of a task.
+	taskMaxImagesEnvName = "FACE_TRACK__TASK_MAX_IMAGES"
+
+	// userQuotaBytesEnvName is the env variable key for the storage quota of a user in bytes; zero is unlimited.
+	userQuotaBytesEnvName = "FACE_TRACK__USER_QUOTA_BYTES"
 )
 
-// Service is a struct that embeds the Task interface and provides methods to interact
-// with task-related functionalities.
+// Service is a struct that embeds the Task, Queue, Events and Webhooks interfaces and provides methods
+// to interact with task-related functionalities, background processing, processing progress and callbacks.
 type Service struct {
 	Task
+	Queue
+	Events
+	Webhooks
 }
 
 // NewServiceWithRepo creates a new instance of Service, initializing it with the task service
@@ -40,19 +114,104 @@ func NewServiceWithRepo() (srvs *Service) {
 		log.Fatalf("Error initializing database: %v", err)
 	}
 
-	repo := repo.NewRepo(db)
+	detector, err := detector.NewDetector()
+	if err != nil {
+		log.Fatalf("Error initializing face detector: %v", err)
+	}
+
+	store, err := blob_store.NewBlobStore()
+	if err != nil {
+		log.Fatalf("Error initializing blob store: %v", err)
+	}
+
+	repo := repo.NewRepo(db, detector, store)
+
+	imageMaxAttempts := tools.GetEnvInt(imageMaxAttemptsEnvName, 3)
+
+	events := event_bus.New()
+
+	webhookService := webhook_service.New(repo, webhook_service.Config{
+		URL:          os.Getenv(webhookUrlEnvName),
+		Secret:       os.Getenv(webhookSecretEnvName),
+		Timeout:      tools.GetEnvDuration(webhookTimeoutEnvName, 10*time.Second),
+		MaxAttempts:  tools.GetEnvInt(webhookMaxAttemptsEnvName, 5),
+		RetryDelay:   tools.GetEnvDuration(webhookRetryDelayEnvName, 10*time.Second),
+		PollInterval: tools.GetEnvDuration(queuePollIntervalEnvName, time.Second),
+	})
+
+	archiveLimits := archive.DefaultLimits()
+	archiveLimits.MaxArchiveBytes = int64(tools.GetEnvInt(archiveMaxBytesEnvName, int(archiveLimits.MaxArchiveBytes)))
+	archiveLimits.MaxEntries = tools.GetEnvInt(archiveMaxEntriesEnvName, archiveLimits.MaxEntries)
+	archiveLimits.MaxEntryBytes = int64(tools.GetEnvInt(archiveMaxEntryBytesEnvName, int(archiveLimits.MaxEntryBytes)))
+	archiveLimits.MaxTotalBytes = int64(tools.GetEnvInt(archiveMaxTotalBytesEnvName, int(archiveLimits.MaxTotalBytes)))
+
+	taskService := task_service.New(
+		repo,
+		events,
+		webhookService,
+		imageMaxAttempts,
+		archiveLimits,
+		tools.GetEnvInt(duplicateDistanceEnvName, 10),
+		task_model.UploadLimits{
+			MaxImageBytes:  int64(tools.GetEnvInt(imageMaxBytesEnvName, 20<<20)),
+			MaxImageSide:   tools.GetEnvInt(imageMaxSideEnvName, 10000),
+			MaxImagePixels: tools.GetEnvInt(imageMaxPixelsEnvName, 40_000_000),
+			MaxTaskImages:  tools.GetEnvInt(taskMaxImagesEnvName, 10000),
+			QuotaBytes:     int64(tools.GetEnvInt(userQuotaBytesEnvName, 0)),
+		},
+	)
 
 	return &Service{
-		Task: task_service.New(repo),
+		Task: taskService,
+		Queue: job_service.New(
+			repo,
+			events,
+			taskService,
+			webhookService,
+			tools.GetEnvInt(workersEnvName, 4),
+			tools.GetEnvDuration(queuePollIntervalEnvName, time.Second),
+			tools.GetEnvDuration(taskLeaseEnvName, time.Minute),
+			tools.GetEnvInt(jobMaxAttemptsEnvName, 3),
+			imageMaxAttempts,
+		),
+		Events:   events,
+		Webhooks: webhookService,
 	}
 }
 
 // Task defines the interface for interacting with task-related functionalities.
 type Task interface {
 	GetTaskById(taskId int) (task *task_model.Task, err error)
-	CreateTask() (taskId int, err error)
+	GetTaskStatus(taskId int) (task *task_model.Task, err error)
+	ListTasks(filter *task_model.TaskFilter) (list *task_model.TaskList, err error)
+	CreateTask(request *task_model.CreateTaskRequest) (taskId int, err error)
 	DeleteTask(taskId int) error
-	AddImageToTask(taskId int, fileData *task_model.FileData) error
+	AddImagesToTask(taskId int, next func() (*task_model.FileData, error)) (results []*task_model.UploadResult, err error)
+	AddArchiveToTask(taskId int, fileData *task_model.FileData) (results []*task_model.UploadResult, err error)
 	UpdateTaskStatus(taskId int, status string) error
-	ProcessTask(taskId int)
+	ProcessTask(ctx context.Context, taskId int)
+	GetTaskResponses(taskId int) (responses []*task_model.ImageResponse, err error)
+	GetTaskImageFile(taskId int, imageName string) (image *task_model.Image, file io.ReadCloser, err error)
+	RecomputeTask(taskId int) error
+	GetTaskDuplicates(taskId int) (clusters []*task_model.DuplicateCluster, err error)
+}
+
+// Queue defines the interface for background processing of tasks.
+type Queue interface {
+	EnqueueTask(taskId int) error
+	RetryTask(taskId int) error
+	CancelTask(taskId int) error
+	StartWorkers(ctx context.Context)
+	WaitWorkers()
+}
+
+// Events defines the interface for following task processing progress.
+type Events interface {
+	Subscribe(taskId int) (events <-chan *event_model.Event, unsubscribe func())
+}
+
+// Webhooks defines the interface for delivering callbacks about finished tasks.
+type Webhooks interface {
+	StartDelivery(ctx context.Context)
+	WaitDelivery()
 }
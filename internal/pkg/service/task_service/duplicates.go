@@ -0,0 +1,104 @@
+package task_service
+
+import (
+	"cmp"
+	"face-track/internal/pkg/imaging"
+	"face-track/internal/pkg/model/task_model"
+	"slices"
+	"strconv"
+)
+
+// GetTaskDuplicates returns clusters of near-duplicate images of the task, such as burst shots,
+// found by the perceptual hashes of the images.
+func (s *TaskService) GetTaskDuplicates(taskId int) (clusters []*task_model.DuplicateCluster, err error) {
+
+	if _, err = s.repo.GetTaskById(taskId); err != nil {
+		return nil, err
+	}
+
+	images, err := s.repo.GetTaskImages(taskId)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters = make([]*task_model.DuplicateCluster, 0)
+
+	for _, cluster := range s.duplicateClusters(images) {
+		names := make([]string, 0, len(cluster))
+		for _, image := range cluster {
+			names = append(names, image.ImageName)
+		}
+
+		clusters = append(clusters, &task_model.DuplicateCluster{
+			Kept:   keptImage(cluster).ImageName,
+			Images: names,
+		})
+	}
+
+	return clusters, nil
+}
+
+// duplicateClusters groups near-duplicate images in the order of upload; images without a perceptual hash
+// are never duplicates.
+func (s *TaskService) duplicateClusters(images []*task_model.Image) (clusters [][]*task_model.Image) {
+
+	hashed := make([]*task_model.Image, 0, len(images))
+	hashes := make([]uint64, 0, len(images))
+
+	images = slices.Clone(images)
+	slices.SortFunc(images, func(a, b *task_model.Image) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+
+	for _, image := range images {
+		hash, err := strconv.ParseUint(image.DHash, 16, 64)
+		if err != nil {
+			continue
+		}
+
+		hashed = append(hashed, image)
+		hashes = append(hashes, hash)
+	}
+
+	for _, indexes := range imaging.Clusters(hashes, s.duplicateDistance) {
+		cluster := make([]*task_model.Image, 0, len(indexes))
+		for _, i := range indexes {
+			cluster = append(cluster, hashed[i])
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
+
+// keptImage returns the image of the cluster counted in the statistics: the first processed one.
+func keptImage(cluster []*task_model.Image) *task_model.Image {
+	for _, image := range cluster {
+		if image.Status == "done" {
+			return image
+		}
+	}
+
+	return cluster[0]
+}
+
+// excludedImages returns IDs of the task images left out of the statistics:
+// near-duplicates other than the kept image of each cluster, if the task excludes them.
+func (s *TaskService) excludedImages(task *task_model.Task) map[int]bool {
+	excluded := make(map[int]bool)
+
+	if !task.ExcludeDuplicates {
+		return excluded
+	}
+
+	for _, cluster := range s.duplicateClusters(task.Images) {
+		kept := keptImage(cluster)
+		for _, image := range cluster {
+			if image != kept {
+				excluded[image.Id] = true
+			}
+		}
+	}
+
+	return excluded
+}
@@ -0,0 +1,168 @@
+package task_service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"face-track/internal/pkg/model/task_model"
+	"face-track/tools"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTasksLimit is the page size of the task list if none is requested.
+	defaultTasksLimit = 20
+
+	// maxTasksLimit is the largest page size of the task list.
+	maxTasksLimit = 100
+)
+
+// taskStatuses lists the values of the task status.
+var taskStatuses = []string{"new", "in_progress", "completed", "completed_with_errors", "error", "cancelled"}
+
+// taskSortFields lists the fields the task list can be sorted by.
+var taskSortFields = []string{"id", "createdAt", "updatedAt", "facesTotal"}
+
+// ListTasks returns a page of tasks matching the filter. Tasks are sorted by creation time,
+// newest first, unless another order is requested; the next page starts at the returned cursor.
+func (s *TaskService) ListTasks(filter *task_model.TaskFilter) (list *task_model.TaskList, err error) {
+
+	if err = normalizeTaskFilter(filter); err != nil {
+		return nil, fmt.Errorf("%w: %v", tools.ErrInvalidInput, err)
+	}
+
+	// request one more task to know whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+
+	tasks, err := s.repo.ListTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	list = &task_model.TaskList{}
+
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		list.NextCursor = encodeTaskCursor(taskCursor(filter.Sort, tasks[limit-1]))
+	}
+
+	list.Tasks = make([]*task_model.TaskListItem, len(tasks))
+	for i, task := range tasks {
+		list.Tasks[i] = task_model.NewTaskListItem(task)
+	}
+
+	return list, nil
+}
+
+// normalizeTaskFilter validates the filter, fills in the defaults and decodes the cursor.
+func normalizeTaskFilter(filter *task_model.TaskFilter) (err error) {
+
+	// statuses may be given as repeated or comma-separated values
+	var statuses []string
+	for _, value := range filter.Statuses {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status == "" {
+				continue
+			}
+			if !slices.Contains(taskStatuses, status) {
+				return fmt.Errorf("unknown task status: %s", status)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	filter.Statuses = statuses
+
+	if filter.Sort == "" {
+		filter.Sort = "createdAt"
+	}
+	if !slices.Contains(taskSortFields, filter.Sort) {
+		return fmt.Errorf("unknown sort field: %s", filter.Sort)
+	}
+
+	if filter.Order == "" {
+		filter.Order = "desc"
+	}
+	if filter.Order != "asc" && filter.Order != "desc" {
+		return fmt.Errorf("order must be asc or desc")
+	}
+
+	switch {
+	case filter.Limit < 0:
+		return fmt.Errorf("limit must be positive")
+	case filter.Limit == 0:
+		filter.Limit = defaultTasksLimit
+	case filter.Limit > maxTasksLimit:
+		filter.Limit = maxTasksLimit
+	}
+
+	if filter.FacesMin != nil && filter.FacesMax != nil && *filter.FacesMin > *filter.FacesMax {
+		return fmt.Errorf("facesMin must not exceed facesMax")
+	}
+
+	if filter.Cursor != "" {
+		filter.After, err = decodeTaskCursor(filter.Cursor, filter.Sort)
+		if err != nil {
+			return fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return nil
+}
+
+// taskCursor returns the position of the task in the list sorted by the field.
+func taskCursor(sort string, task *task_model.Task) *task_model.TaskCursor {
+	cursor := &task_model.TaskCursor{Sort: sort, Id: task.Id}
+
+	switch sort {
+	case "createdAt":
+		cursor.Value = task.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updatedAt":
+		cursor.Value = task.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case "facesTotal":
+		cursor.Value = strconv.Itoa(task.Statistics.FacesTotal)
+	default:
+		cursor.Value = strconv.Itoa(task.Id)
+	}
+
+	return cursor
+}
+
+// encodeTaskCursor returns the cursor as an opaque URL-safe string.
+func encodeTaskCursor(cursor *task_model.TaskCursor) string {
+	b, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeTaskCursor parses the cursor encoded by encodeTaskCursor and checks it belongs to the list
+// sorted by the field.
+func decodeTaskCursor(s string, sort string) (cursor *task_model.TaskCursor, err error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor = &task_model.TaskCursor{}
+	if err = json.Unmarshal(b, cursor); err != nil {
+		return nil, err
+	}
+
+	if cursor.Sort != sort {
+		return nil, errors.New("cursor of another sort field")
+	}
+
+	switch sort {
+	case "createdAt", "updatedAt":
+		_, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	default:
+		_, err = strconv.Atoi(cursor.Value)
+	}
+
+	return cursor, err
+}
@@ -2,32 +2,65 @@
 package task_service
 
 import (
+	"context"
 	"errors"
+	"face-track/internal/pkg/archive"
+	"face-track/internal/pkg/event_bus"
+	"face-track/internal/pkg/imaging"
+	"face-track/internal/pkg/model/detector_model"
+	"face-track/internal/pkg/model/event_model"
+	"face-track/internal/pkg/model/face_cloud_model"
 	"face-track/internal/pkg/model/task_model"
 	"face-track/internal/pkg/repo"
+	"face-track/tools"
 	"fmt"
 	"image"
+	"io"
 	"log"
-	"os"
-	"sync"
+	"net"
+	"net/url"
 
 	"golang.org/x/sync/errgroup"
 )
 
-const (
-	// foldersAmount defines the maximum number of nested folders for organizing task images.
-	foldersAmount = 30000
-)
+// Notifier notifies external systems about finished tasks.
+type Notifier interface {
+	NotifyTask(taskId int) error
+}
 
 // TaskService is a struct that holds methods for managing tasks and processing associated images.
 type TaskService struct {
-	repo *repo.Repo
+	repo              *repo.Repo
+	events            *event_bus.EventBus
+	notifier          Notifier
+	imageMaxAttempts  int
+	archiveLimits     archive.Limits
+	duplicateDistance int
+	uploadLimits      task_model.UploadLimits
 }
 
 // New creates a new instance of TaskService, initializing it with the provided repo.
-func New(repo *repo.Repo) *TaskService {
+// Processing progress is published to the event bus, finished tasks are reported to the notifier.
+// Detection of an image is not tried more than imageMaxAttempts times. Uploaded archives are bounded by archiveLimits.
+// Images whose perceptual hashes differ in at most duplicateDistance bits are near-duplicates.
+// Uploaded images are bounded by uploadLimits.
+func New(
+	repo *repo.Repo,
+	events *event_bus.EventBus,
+	notifier Notifier,
+	imageMaxAttempts int,
+	archiveLimits archive.Limits,
+	duplicateDistance int,
+	uploadLimits task_model.UploadLimits,
+) *TaskService {
 	return &TaskService{
-		repo: repo,
+		repo:              repo,
+		events:            events,
+		notifier:          notifier,
+		imageMaxAttempts:  imageMaxAttempts,
+		archiveLimits:     archiveLimits,
+		duplicateDistance: duplicateDistance,
+		uploadLimits:      uploadLimits,
 	}
 }
 
@@ -36,6 +69,11 @@ func (s *TaskService) GetTaskById(taskId int) (task *task_model.Task, err error)
 	return s.getFullTaskData(taskId)
 }
 
+// GetTaskStatus returns task data with its status and statistics but without images by task ID.
+func (s *TaskService) GetTaskStatus(taskId int) (task *task_model.Task, err error) {
+	return s.repo.GetTaskById(taskId)
+}
+
 // GetTaskById returns task data as an object.
 func (s *TaskService) getFullTaskData(taskId int) (task *task_model.Task, err error) {
 
@@ -69,13 +107,48 @@ func (s *TaskService) getFullTaskData(taskId int) (task *task_model.Task, err er
 }
 
 // CreateTask creates new task and returns its ID.
-func (s *TaskService) CreateTask() (taskId int, err error) {
-	return s.repo.CreateTask()
+// The optional callback URL is notified when the task processing finishes;
+// near-duplicate images are left out of the statistics if requested.
+func (s *TaskService) CreateTask(request *task_model.CreateTaskRequest) (taskId int, err error) {
+
+	if request.CallbackUrl != "" {
+		u, err := url.Parse(request.CallbackUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return 0, fmt.Errorf("%w: callback url must be an absolute http or https url", tools.ErrInvalidInput)
+		}
+
+		if err = checkCallbackHost(u.Hostname()); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.repo.CreateTask(request)
+}
+
+// checkCallbackHost returns an error if the callback host is or resolves to a loopback, link-local,
+// private or unspecified address, so callbacks can not be aimed at the internal network.
+func checkCallbackHost(host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return fmt.Errorf("%w: callback host can not be resolved", tools.ErrInvalidInput)
+	}
+
+	for _, addr := range addrs {
+		ip := addr.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+			ip.IsPrivate() || ip.IsUnspecified() {
+			return fmt.Errorf("%w: callback url must not point to a private network", tools.ErrInvalidInput)
+		}
+	}
+
+	return nil
 }
 
-// DeleteTask deletes all task data from db and disk; returns error.
+// DeleteTask deletes all task data from db and the blob store; returns error.
+// Files shared with images of other tasks are kept.
 func (s *TaskService) DeleteTask(taskId int) (err error) {
 	var task *task_model.Task
+	var images []*task_model.Image
 
 	task, err = s.repo.GetTaskById(taskId)
 	if err != nil {
@@ -83,157 +156,351 @@ func (s *TaskService) DeleteTask(taskId int) (err error) {
 	}
 
 	if task.Status == "in_progress" {
-		return errors.New("unable to delete task: processing is in progress")
+		return fmt.Errorf("%w: unable to delete task: processing is in progress", tools.ErrConflict)
+	}
+
+	images, err = s.repo.GetTaskImages(taskId)
+	if err != nil {
+		return err
 	}
 
 	if err = s.repo.DeleteTask(taskId); err != nil {
 		return err
 	}
 
-	if err = s.deleteTaskImagesFromDisk(task.Id); err != nil {
-		log.Printf("error deleting images from disk: %v\n", err)
+	if err = s.repo.ReleaseImageBlobs(imageChecksums(images)); err != nil {
+		log.Printf("error releasing task %d files: %v\n", task.Id, err)
+	}
+
+	if err = s.repo.DeleteTaskFiles(task.Id); err != nil {
+		log.Printf("error deleting task %d files: %v\n", task.Id, err)
 	}
 
 	return nil
 }
 
-// deleteTaskImagesFromDisk removes task image folder with content from the disk; returns err.
-func (s *TaskService) deleteTaskImagesFromDisk(taskId int) error {
+// AddImagesToTask validates and adds uploaded images to task: to the blob store and database.
+// Files are taken from next one at a time until it returns io.EOF, so they are never all held in memory.
+// Invalid files are rejected with a reason, the accepted ones are registered in a single transaction;
+// returns tools.ErrUnprocessable if all files were rejected.
+func (s *TaskService) AddImagesToTask(taskId int, next func() (*task_model.FileData, error)) (results []*task_model.UploadResult, err error) {
 
-	subFolderID := taskId % foldersAmount
-	path := fmt.Sprintf("/face track/images/%d/%d", subFolderID, taskId)
+	if err = s.validateTaskStatus(taskId); err != nil {
+		return nil, err
+	}
 
-	return os.RemoveAll(path)
+	results, err = s.addImages(taskId, next)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: no images uploaded", tools.ErrInvalidInput)
+	}
+
+	if err = checkAccepted(results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
 }
 
-// AddImageToTask validates and adds a new image to task: to disk and database.
-func (s *TaskService) AddImageToTask(taskId int, fileData *task_model.FileData) (err error) {
+// AddArchiveToTask extracts images of the uploaded ZIP or TAR(.gz) archive and adds them to task.
+// Entries which are not supported images are skipped and reported along with the images.
+func (s *TaskService) AddArchiveToTask(taskId int, fileData *task_model.FileData) (results []*task_model.UploadResult, err error) {
 
-	if err = s.validateTaskImage(taskId, fileData); err != nil {
-		return err
+	if err = s.validateTaskStatus(taskId); err != nil {
+		return nil, err
 	}
 
-	// decode file to image type
-	var image image.Image
-	image, err = s.repo.DecodeFile(fileData)
+	extractor, err := archive.NewExtractor(fileData.File, s.archiveLimits)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer extractor.Close()
 
-	// save image on disk
-	fileName := fileData.FileHeader.Filename
-	imageRow, err := s.repo.SaveImageDisk(taskId, image, fileName)
+	results, err = s.addImages(taskId, extractor.Next)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.repo.CreateImage(imageRow)
-}
+	results = append(results, extractor.Skipped()...)
 
-// validateImage validates the image and related task data; returns error.
-func (s *TaskService) validateTaskImage(taskId int, fileData *task_model.FileData) error {
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: archive is empty", tools.ErrInvalidInput)
+	}
 
-	// validate file extension
-	if fileData.FileHeader.Header.Get("Content-Type") != "image/jpeg" {
-		return errors.New("unsupported file extension")
+	if err = checkAccepted(results); err != nil {
+		return nil, err
 	}
 
+	return results, nil
+}
+
+// checkAccepted returns tools.ErrUnprocessable with the reason of the first file if no file was accepted.
+func checkAccepted(results []*task_model.UploadResult) error {
+	for _, result := range results {
+		if result.Status == "accepted" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no image accepted: %s: %s", tools.ErrUnprocessable, results[0].FileName, results[0].Reason)
+}
+
+// validateTaskStatus returns error if the task status does not allow adding images.
+func (s *TaskService) validateTaskStatus(taskId int) error {
+
 	// Check task status
 	taskStatusNew := s.repo.ConfirmTaskStatus(taskId, "new")
 
 	if !taskStatusNew {
-		return errors.New("failed to add image to task: task status does not allow adding images")
+		return fmt.Errorf("%w: failed to add image to task: task status does not allow adding images", tools.ErrConflict)
 	}
 
 	return nil
 }
 
+// addImages saves the files taken from next to the blob store and registers the accepted images in a single transaction.
+// The upload fails as soon as the images exceed the limits of the task or the quota of its owner.
+func (s *TaskService) addImages(taskId int, next func() (*task_model.FileData, error)) (results []*task_model.UploadResult, err error) {
+	var imageRows []*task_model.Image
+	var usage *task_model.UploadUsage
+
+	usage, err = s.repo.GetUploadUsage(taskId)
+	if err != nil {
+		return nil, err
+	}
+
+	// release saved files if the images are not registered
+	defer func() {
+		if err != nil && len(imageRows) > 0 {
+			if err := s.repo.ReleaseImageBlobs(imageChecksums(imageRows)); err != nil {
+				log.Printf("error releasing task %d files: %v\n", taskId, err)
+			}
+		}
+	}()
+
+	for {
+		var fileData *task_model.FileData
+		var imageRow *task_model.Image
+		var reason string
+
+		fileData, err = next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := &task_model.UploadResult{FileName: fileData.FileName}
+		results = append(results, result)
+
+		imageRow, reason, err = s.saveTaskImage(taskId, fileData, *usage)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			result.Status = "rejected"
+			result.Reason = reason
+			continue
+		}
+
+		imageRows = append(imageRows, imageRow)
+		*usage = usage.Add(imageRow)
+		result.Status = "accepted"
+		result.ImageName = imageRow.ImageName
+	}
+
+	if len(imageRows) > 0 {
+		if err = s.repo.CreateImages(taskId, imageRows, s.uploadLimits); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// imageChecksums returns checksums of the images, one per image.
+func imageChecksums(images []*task_model.Image) []string {
+	checksums := make([]string, 0, len(images))
+	for _, image := range images {
+		if image.Checksum != "" {
+			checksums = append(checksums, image.Checksum)
+		}
+	}
+
+	return checksums
+}
+
+// saveTaskImage validates and saves the uploaded image to the blob store; returns the image record,
+// or the reason the file was rejected for. The format is detected by the file content.
+// The file is read up to the size limit only; image dimensions are checked before the pixels are decoded.
+// The file must fit the upload usage limits.
+func (s *TaskService) saveTaskImage(taskId int, fileData *task_model.FileData, usage task_model.UploadUsage) (imageRow *task_model.Image, reason string, err error) {
+
+	file := fileData.File
+	if s.uploadLimits.MaxImageBytes > 0 {
+		// one byte past the limit tells a file exceeding it
+		file = io.LimitReader(file, s.uploadLimits.MaxImageBytes+1)
+	}
+
+	data, err := io.ReadAll(file)
+	if errors.Is(err, tools.ErrTooLarge) {
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("failed to read file: %v", err), nil
+	}
+	if s.uploadLimits.MaxImageBytes > 0 && int64(len(data)) > s.uploadLimits.MaxImageBytes {
+		return nil, fmt.Sprintf("file is larger than %d bytes", s.uploadLimits.MaxImageBytes), nil
+	}
+
+	config, _, err := imaging.DecodeConfig(data)
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		return nil, "unsupported image format", nil
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("failed to decode image: %v", err), nil
+	}
+	if reason = s.checkDimensions(config); reason != "" {
+		return nil, reason, nil
+	}
+
+	if err = usage.Add(&task_model.Image{Size: int64(len(data))}).CheckLimits(s.uploadLimits); err != nil {
+		return nil, "", err
+	}
+
+	// decode file to image type
+	var image image.Image
+	var format string
+	image, format, err = s.repo.DecodeFile(data)
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		return nil, "unsupported image format", nil
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("failed to decode image: %v", err), nil
+	}
+
+	// save image to the blob store
+	imageRow, err = s.repo.SaveImageFile(taskId, image, fileData.FileName, format, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return imageRow, "", nil
+}
+
+// checkDimensions returns the reason the image of the given dimensions is rejected for,
+// or an empty string if the image is within the limits.
+func (s *TaskService) checkDimensions(config image.Config) (reason string) {
+	limits := s.uploadLimits
+
+	if limits.MaxImageSide > 0 && max(config.Width, config.Height) > limits.MaxImageSide {
+		return fmt.Sprintf("image is %dx%d pixels, the largest side allowed is %d pixels",
+			config.Width, config.Height, limits.MaxImageSide)
+	}
+
+	if limits.MaxImagePixels > 0 && config.Width*config.Height > limits.MaxImagePixels {
+		return fmt.Sprintf("image is %dx%d pixels, at most %d pixels are allowed",
+			config.Width, config.Height, limits.MaxImagePixels)
+	}
+
+	return ""
+}
+
 // UpdateTaskStatus updates the task status to the specified value.
 func (s *TaskService) UpdateTaskStatus(taskId int, status string) error {
 	return s.repo.UpdateTaskStatus(taskId, status)
 }
 
-// ProcessTask processes tasks' images concurrently.
-func (s *TaskService) ProcessTask(taskId int) {
+// ProcessTask processes tasks' images concurrently; the context bounds the requests to the face detector.
+// When the context is cancelled, in-flight requests are aborted and the images processed so far are kept.
+// An image failing detection is marked "failed" and does not stop the other images.
+func (s *TaskService) ProcessTask(ctx context.Context, taskId int) {
 	var err error
 	var task *task_model.Task
 
 	task, err = s.getFullTaskData(taskId)
 	if err != nil {
-		log.Println(err)
-		_ = s.repo.UpdateTaskStatus(taskId, "error")
+		s.failTask(taskId, err)
 		return
 	}
-	if task.Status == "completed" {
+	// the task was cancelled or already finished
+	if task.Status != "in_progress" {
 		return
 	}
 
 	g := new(errgroup.Group)
 	g.SetLimit(10)
 
-	var Mu sync.RWMutex
-	var facesToSave []*task_model.Face
-	var imagesToSetDone []*task_model.Image
-
 	if len(task.Images) > 0 {
-
-		// get token for external API authentication
-		token, err := s.repo.GetFaceCloudToken()
-		if err != nil {
-			log.Println(err)
-			_ = s.repo.UpdateTaskStatus(taskId, "error")
-			return
-		}
-
 		for _, img := range task.Images {
-			// skip processed images
-			if img.DoneFlag {
+			// skip processed images and images failed too many times
+			if img.Status == "done" || (img.Status == "failed" && img.Attempts >= s.imageMaxAttempts) {
 				continue
 			}
 
 			currImage := img
 			g.Go(func() error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 
-				// send request to face cloud
-				imageData, err := s.repo.GetFaceDetectionData(currImage, token)
+				// send image to face detector unless its content was analyzed already
+				imageData, cached, err := s.detectFaces(ctx, currImage)
 				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					return s.failImage(currImage, err)
+				}
+
+				// keep the raw response for audit and re-analysis
+				if err = s.repo.SaveImageResponse(currImage.Id, imageData); err != nil {
 					log.Println(err)
 					return err
 				}
 
 				// process recognised faces data
-				for _, faceData := range imageData.Data {
-					newFace := &task_model.Face{
-						ImageId: currImage.Id,
-						Gender:  faceData.Demographics.Gender,
-						Age:     int(faceData.Demographics.Age.Mean),
-						Height:  faceData.Bbox.Height,
-						Width:   faceData.Bbox.Width,
-						X:       faceData.Bbox.X,
-						Y:       faceData.Bbox.Y,
-					}
+				uprightFaces(currImage, imageData)
+				facesToSave := make([]*task_model.Face, 0, len(imageData.Faces))
+				for _, faceData := range imageData.Faces {
+					facesToSave = append(facesToSave, newFace(currImage.Id, faceData))
+				}
 
-					Mu.Lock()
-					facesToSave = append(facesToSave, newFace)
-					Mu.Unlock()
+				// save processed image to db right away, so an interrupted task resumes from here
+				if err = s.repo.SaveProcessedData(facesToSave, []*task_model.Image{currImage}); err != nil {
+					log.Println(err)
+					return err
 				}
 
-				Mu.Lock()
-				imagesToSetDone = append(imagesToSetDone, currImage)
-				Mu.Unlock()
+				s.events.Publish(event_model.NewEvent(event_model.TypeImageProcessed, taskId, event_model.ImageProcessed{
+					ImageName: currImage.ImageName,
+					Status:    "done",
+					Cached:    cached,
+				}))
+				if len(facesToSave) > 0 {
+					s.events.Publish(event_model.NewEvent(event_model.TypeFacesFound, taskId, event_model.FacesFound{
+						ImageName: currImage.ImageName,
+						Faces:     len(facesToSave),
+					}))
+				}
 
-				return err
+				return nil
 			})
 		}
 	}
 	err = g.Wait()
 
-	// save processed images to db
-	s.repo.SaveProcessedData(facesToSave, imagesToSetDone)
+	if ctx.Err() != nil {
+		log.Printf("processing of task %d was stopped: %v\n", taskId, ctx.Err())
+		return
+	}
 
 	if err != nil {
-		log.Println(err)
-		_ = s.repo.UpdateTaskStatus(taskId, "error")
+		s.failTask(taskId, err)
 		return
 	}
 
@@ -248,12 +515,320 @@ func (s *TaskService) ProcessTask(taskId int) {
 	s.concludeTask(task)
 }
 
-// concludeTask calculates task statistics and saves them to the database.
+// detectFaces returns the detection result of the image; the result cached for the image content is reused,
+// otherwise the image is sent to the face detector and the result is cached.
+func (s *TaskService) detectFaces(ctx context.Context, image *task_model.Image) (result *detector_model.DetectResult, cached bool, err error) {
+
+	if image.Checksum != "" {
+		result, err = s.repo.GetCachedDetection(image.Checksum)
+		if err == nil {
+			return result, true, nil
+		}
+		if !errors.Is(err, tools.ErrNotFound) {
+			log.Printf("error reading cached detection of image %d: %v\n", image.Id, err)
+		}
+	}
+
+	result, err = s.repo.GetFaceDetectionData(ctx, image)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if image.Checksum != "" {
+		if err = s.repo.CacheDetection(image.Checksum, result); err != nil {
+			log.Printf("error caching detection of image %d: %v\n", image.Id, err)
+		}
+	}
+
+	return result, false, nil
+}
+
+// GetTaskResponses returns raw detection responses stored for the task images.
+func (s *TaskService) GetTaskResponses(taskId int) (responses []*task_model.ImageResponse, err error) {
+
+	if _, err = s.repo.GetTaskById(taskId); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetImageResponses(taskId)
+}
+
+// GetTaskImageFile returns the image of the task and its file exactly as uploaded; the file must be closed.
+func (s *TaskService) GetTaskImageFile(taskId int, imageName string) (image *task_model.Image, file io.ReadCloser, err error) {
+
+	image, err = s.repo.GetTaskImage(taskId, imageName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err = s.repo.OpenImageFile(image)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return image, file, nil
+}
+
+// RecomputeTask rebuilds task faces and statistics from the stored raw responses
+// without calling the detection provider.
+func (s *TaskService) RecomputeTask(taskId int) (err error) {
+	var task *task_model.Task
+
+	task, err = s.repo.GetTaskById(taskId)
+	if err != nil {
+		return err
+	}
+
+	if task.Status == "in_progress" {
+		return fmt.Errorf("%w: unable to recompute task: processing is in progress", tools.ErrConflict)
+	}
+
+	responses, err := s.repo.GetImageResponses(taskId)
+	if err != nil {
+		return err
+	}
+
+	if len(responses) == 0 {
+		return fmt.Errorf("%w: unable to recompute task: no stored responses", tools.ErrConflict)
+	}
+
+	images, err := s.repo.GetTaskImages(taskId)
+	if err != nil {
+		return err
+	}
+
+	imagesById := make(map[int]*task_model.Image, len(images))
+	for _, image := range images {
+		imagesById[image.Id] = image
+	}
+
+	imageIds := make([]int, 0, len(responses))
+	var faces []*task_model.Face
+
+	for _, response := range responses {
+		imageData, err := s.repo.ParseImageResponse(response)
+		if err != nil {
+			return err
+		}
+
+		if image, ok := imagesById[response.ImageId]; ok {
+			uprightFaces(image, imageData)
+		}
+
+		imageIds = append(imageIds, response.ImageId)
+		for _, faceData := range imageData.Faces {
+			faces = append(faces, newFace(response.ImageId, faceData))
+		}
+	}
+
+	if err = s.repo.ReplaceImageFaces(imageIds, faces); err != nil {
+		return err
+	}
+
+	// request updated task data
+	task, err = s.getFullTaskData(taskId)
+	if err != nil {
+		return err
+	}
+
+	if len(responses) == len(task.Images) {
+		summarizeTask(task, s.excludedImages(task))
+
+		if err = s.repo.UpdateTaskStatistics(task); err != nil {
+			return err
+		}
+
+		s.announceTask(task)
+		return nil
+	}
+
+	// some images were never processed: refresh the statistics, keep the status
+	calculateStatistics(task, s.excludedImages(task))
+
+	return s.repo.UpdateTaskStatistics(task)
+}
+
+// uprightFaces maps faces found on the image rotated by the detector back to the upright rendition,
+// so bounding boxes and landmarks are reported in its coordinates. The rendition is turned upright already,
+// so a rotation is a sign of a wrong or missing EXIF orientation.
+func uprightFaces(img *task_model.Image, result *detector_model.DetectResult) {
+	if result.Rotation%360 == 0 {
+		return
+	}
+
+	log.Printf("image %d: detector rotated the image by %d degrees, EXIF orientation %d\n",
+		img.Id, result.Rotation, img.Orientation)
+
+	if result.Rotation%90 != 0 || img.Width == 0 || img.Height == 0 {
+		// unknown geometry, the coordinates are kept as is
+		return
+	}
+
+	size := image.Point{X: img.Width, Y: img.Height}
+
+	for _, face := range result.Faces {
+		rect := imaging.UnrotateRect(image.Rect(
+			face.Bbox.X,
+			face.Bbox.Y,
+			face.Bbox.X+face.Bbox.Width,
+			face.Bbox.Y+face.Bbox.Height,
+		), result.Rotation, size)
+
+		face.Bbox = detector_model.Bbox{
+			Height: rect.Dy(),
+			Width:  rect.Dx(),
+			X:      rect.Min.X,
+			Y:      rect.Min.Y,
+		}
+
+		for i, landmark := range face.Landmarks {
+			point := imaging.UnrotatePoint(image.Point{X: landmark.X, Y: landmark.Y}, result.Rotation, size)
+			face.Landmarks[i] = detector_model.Landmark{X: point.X, Y: point.Y}
+		}
+	}
+}
+
+// newFace converts a detected face to a face row of the image.
+func newFace(imageId int, faceData *detector_model.Face) *task_model.Face {
+
+	face := &task_model.Face{
+		ImageId:       imageId,
+		Gender:        faceData.Gender,
+		Age:           int(faceData.Age),
+		AgeVariance:   faceData.AgeVariance,
+		Ethnicity:     faceData.Ethnicity,
+		Height:        faceData.Bbox.Height,
+		Width:         faceData.Bbox.Width,
+		X:             faceData.Bbox.X,
+		Y:             faceData.Bbox.Y,
+		Score:         faceData.Score,
+		Liveness:      faceData.Liveness,
+		FacialHair:    faceData.Attributes.FacialHair,
+		Glasses:       faceData.Attributes.Glasses,
+		HairColor:     faceData.Attributes.HairColor,
+		HairType:      faceData.Attributes.HairType,
+		Headwear:      faceData.Attributes.Headwear,
+		Landmarks:     make(task_model.Landmarks, 0, len(faceData.Landmarks)),
+		MaskFullFace:  faceData.Masks.FullFace,
+		MaskLowerFace: faceData.Masks.LowerFace,
+		MaskNone:      faceData.Masks.None,
+		MaskOther:     faceData.Masks.Other,
+		Blurriness:    faceData.Quality.Blurriness,
+		Overexposure:  faceData.Quality.Overexposure,
+		Underexposure: faceData.Quality.Underexposure,
+	}
+
+	for _, landmark := range faceData.Landmarks {
+		face.Landmarks = append(face.Landmarks, face_cloud_model.Landmark{X: landmark.X, Y: landmark.Y})
+	}
+
+	return face
+}
+
+// failImage logs the detection error and marks the image as "failed" with the error as a reason.
+func (s *TaskService) failImage(image *task_model.Image, err error) error {
+	log.Printf("image %d failed: %v\n", image.Id, err)
+
+	reason := errorReason(err)
+
+	if err = s.repo.SetImageError(image.Id, reason); err != nil {
+		return err
+	}
+
+	s.events.Publish(event_model.NewEvent(event_model.TypeImageProcessed, image.TaskId, event_model.ImageProcessed{
+		ImageName: image.ImageName,
+		Status:    "failed",
+		Error:     reason,
+	}))
+
+	return nil
+}
+
+// errorReason returns the reason saved for the processing error.
+func errorReason(err error) string {
+	if errors.Is(err, tools.ErrProviderUnavailable) {
+		return tools.ErrProviderUnavailable.Error()
+	}
+
+	return err.Error()
+}
+
+// concludeTask calculates task statistics and saves them to the database along with the final status.
+// The status is saved only while the task is "in_progress", so a task cancelled meanwhile stays cancelled
+// and nobody is notified.
 func (s *TaskService) concludeTask(task *task_model.Task) {
 
+	summarizeTask(task, s.excludedImages(task))
+
+	err := s.repo.FinishTask(task)
+	if errors.Is(err, tools.ErrNotFound) {
+		log.Printf("task %d is no longer in progress, the result is discarded\n", task.Id)
+		return
+	}
+	if err != nil {
+		s.failTask(task.Id, err)
+		return
+	}
+
+	s.announceTask(task)
+}
+
+// summarizeTask calculates task statistics and sets the final status of the task.
+// The task is "completed" if all images were processed, "completed_with_errors" if some of them failed
+// and "error" if all of them failed.
+func summarizeTask(task *task_model.Task, excluded map[int]bool) {
+
+	calculateStatistics(task, excluded)
+	task.Status = "completed"
+	task.StatusReason = ""
+
+	var failed []*task_model.Image
+	for _, image := range task.Images {
+		if image.Status != "done" {
+			failed = append(failed, image)
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+	case len(failed) == len(task.Images):
+		task.Status = "error"
+		task.StatusReason = fmt.Sprintf("all images failed: %s", failed[0].Error)
+	default:
+		task.Status = "completed_with_errors"
+		task.StatusReason = fmt.Sprintf("%d of %d images failed", len(failed), len(task.Images))
+	}
+}
+
+// announceTask publishes the statistics and the final status of the task and notifies about it.
+func (s *TaskService) announceTask(task *task_model.Task) {
+
+	s.events.Publish(event_model.NewEvent(event_model.TypeStatistics, task.Id, task_model.Statistics{
+		FacesTotal:   task.FacesTotal,
+		FacesMale:    task.FacesMale,
+		FacesFemale:  task.FacesFemale,
+		AgeFemaleAvg: task.AgeFemaleAvg,
+		AgeMaleAvg:   task.AgeMaleAvg,
+	}))
+	s.events.Publish(event_model.NewEvent(event_model.TypeStatus, task.Id, event_model.Status{
+		Status: task.Status,
+		Reason: task.StatusReason,
+	}))
+
+	s.notifyTask(task.Id)
+}
+
+// calculateStatistics aggregates faces of the successfully processed task images
+// into the task statistics fields; the excluded images are skipped.
+func calculateStatistics(task *task_model.Task, excluded map[int]bool) {
+
 	var totalFaces, maleFaces, femaleFaces, totalMaleAge, totalFemaleAge int
 
 	for _, image := range task.Images {
+		if image.Status != "done" || excluded[image.Id] {
+			continue
+		}
+
 		for _, face := range image.Faces {
 			totalFaces++
 
@@ -282,11 +857,35 @@ func (s *TaskService) concludeTask(task *task_model.Task) {
 	task.FacesFemale = femaleFaces
 	task.AgeMaleAvg = avgMaleAge
 	task.AgeFemaleAvg = avgFemaleAge
-	task.Status = "completed"
+}
+
+// failTask logs the error and sets the status of the task being processed to "error" with the error as a reason.
+func (s *TaskService) failTask(taskId int, err error) {
+	log.Println(err)
+
+	reason := errorReason(err)
 
-	err := s.repo.UpdateTaskStatistics(task)
+	err = s.repo.SetTaskError(taskId, reason)
+	if errors.Is(err, tools.ErrNotFound) {
+		log.Printf("task %d is no longer in progress, the error is discarded\n", taskId)
+		return
+	}
 	if err != nil {
-		_ = s.repo.UpdateTaskStatus(task.Id, "error")
+		log.Println(err)
 		return
 	}
+
+	s.events.Publish(event_model.NewEvent(event_model.TypeStatus, taskId, event_model.Status{
+		Status: "error",
+		Reason: reason,
+	}))
+
+	s.notifyTask(taskId)
+}
+
+// notifyTask reports the finished task to the notifier; errors are logged.
+func (s *TaskService) notifyTask(taskId int) {
+	if err := s.notifier.NotifyTask(taskId); err != nil {
+		log.Printf("error notifying about task %d: %v\n", taskId, err)
+	}
 }
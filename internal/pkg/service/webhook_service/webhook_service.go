@@ -0,0 +1,243 @@
+// Package webhook_service provides delivery of webhook callbacks notifying about finished tasks.
+package webhook_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"face-track/internal/pkg/model/task_model"
+	"face-track/internal/pkg/model/webhook_model"
+	"face-track/internal/pkg/repo"
+	"face-track/tools"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of the timestamp and the payload: "sha256=<hex>".
+	SignatureHeader = "X-Face-Track-Signature"
+
+	// TimestampHeader carries the Unix time the payload was signed at.
+	TimestampHeader = "X-Face-Track-Timestamp"
+
+	// DeliveryHeader carries the delivery ID, the same for all attempts of a delivery.
+	DeliveryHeader = "X-Face-Track-Delivery"
+
+	// maxRetryDelay caps the delay between delivery attempts.
+	maxRetryDelay = time.Hour
+
+	// defaultTimeout bounds delivery requests when no timeout is configured.
+	defaultTimeout = 10 * time.Second
+
+	// minLease is the shortest time a claimed delivery is kept from other workers.
+	minLease = 30 * time.Second
+)
+
+// Config holds the webhook delivery settings.
+type Config struct {
+	// URL is the callback of tasks created without their own one; empty disables such callbacks.
+	URL string
+
+	// Secret is the HMAC key signing payloads; empty disables signing.
+	Secret string
+
+	// Timeout bounds a delivery request; a non-positive one is replaced with the default.
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryDelay   time.Duration
+	PollInterval time.Duration
+}
+
+// WebhookService queues callbacks of finished tasks and delivers them with retries.
+// Deliveries are stored in the database, so they survive restarts and serve as the delivery log.
+type WebhookService struct {
+	repo   *repo.Repo
+	cfg    Config
+	client *http.Client
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a new WebhookService with the given settings.
+func New(repo *repo.Repo, cfg Config) *WebhookService {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &WebhookService{
+		repo: repo,
+		cfg:  cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// NotifyTask queues a callback with the current task status and statistics
+// to the task callback URL or the global one.
+func (s *WebhookService) NotifyTask(taskId int) (err error) {
+
+	task, err := s.repo.GetTaskById(taskId)
+	if err != nil {
+		return err
+	}
+
+	url := task.CallbackUrl
+	if url == "" {
+		url = s.cfg.URL
+	}
+	if url == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(&webhook_model.Payload{
+		TaskId:       task.Id,
+		Status:       task.Status,
+		StatusReason: task.StatusReason,
+		Statistics:   task.Statistics,
+		Timestamp:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	delivery := &webhook_model.Delivery{
+		TaskId:  task.Id,
+		Url:     url,
+		Payload: task_model.RawJSON(payload),
+	}
+
+	if err = s.repo.CreateDelivery(delivery); err != nil {
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// StartDelivery starts delivering queued callbacks until the context is done.
+func (s *WebhookService) StartDelivery(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.work(ctx)
+	}()
+}
+
+// WaitDelivery blocks until the current delivery attempt has finished and the delivery has stopped.
+func (s *WebhookService) WaitDelivery() {
+	s.wg.Wait()
+}
+
+// work claims and delivers callbacks until the context is done.
+func (s *WebhookService) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		// a delivery abandoned by a dead worker is due again after twice the request timeout, but not sooner than minLease
+		delivery, err := s.repo.ClaimDelivery(max(2*s.cfg.Timeout, minLease))
+		if err == nil {
+			s.deliver(delivery)
+			continue
+		}
+
+		if !errors.Is(err, tools.ErrNotFound) {
+			log.Printf("error claiming webhook delivery: %v\n", err)
+		}
+
+		timer := time.NewTimer(s.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deliver sends the callback and records the outcome of the attempt.
+func (s *WebhookService) deliver(delivery *webhook_model.Delivery) {
+
+	code, err := s.send(delivery)
+	if err == nil {
+		err = s.repo.CompleteDelivery(delivery.Id, code)
+	} else if delivery.Attempts >= s.cfg.MaxAttempts {
+		log.Printf("webhook delivery %d failed: %v\n", delivery.Id, err)
+		err = s.repo.FailDelivery(delivery.Id, code, err.Error())
+	} else {
+		err = s.repo.RetryDelivery(delivery.Id, code, err.Error(), s.retryDelay(delivery.Attempts))
+	}
+
+	if err != nil {
+		log.Printf("error saving webhook delivery %d result: %v\n", delivery.Id, err)
+	}
+}
+
+// send posts the signed payload to the callback URL; returns the response code
+// and error unless the code is 2xx.
+func (s *WebhookService) send(delivery *webhook_model.Delivery) (code int, err error) {
+
+	req, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	req.Header.Set(TimestampHeader, timestamp)
+	if s.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.cfg.Secret, timestamp, delivery.Payload))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain the body, so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// retryDelay returns the delay before the next attempt, doubled after each failed attempt.
+func (s *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := s.cfg.RetryDelay
+
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+// Sign returns the signature of the payload sent at the timestamp: HMAC-SHA256 of "<timestamp>.<payload>"
+// keyed with the secret. Receivers recompute it to verify the callback.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -3,3 +3,13 @@ package tools
 import "errors"
 
 var ErrNotFound = errors.New("resource not found")
+
+var ErrProviderUnavailable = errors.New("provider unavailable")
+
+var ErrInvalidInput = errors.New("invalid input")
+
+var ErrTooLarge = errors.New("request entity too large")
+
+var ErrUnprocessable = errors.New("unprocessable input")
+
+var ErrConflict = errors.New("conflict with the task status")
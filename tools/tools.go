@@ -1,10 +1,10 @@
 package tools
 
 import (
-	"image"
-	"image/jpeg"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 // CheckEnvs checks the environment variables.
@@ -37,13 +37,62 @@ func CreateFolderIfNotExist(path string) {
 	}
 }
 
-// SaveImg saves the image to disk.
-func SaveImg(img image.Image, imgPath string) (err error) {
-	out, err := os.Create(imgPath)
+// GetEnvInt returns the integer value of the env variable, or def if it is not set.
+func GetEnvInt(env string, def int) int {
+	envStr := os.Getenv(env)
+	if envStr == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(envStr)
 	if err != nil {
-		panic(err)
+		log.Fatalf("env variable is not an integer: %s", env)
+	}
+
+	return value
+}
+
+// GetEnvFloat returns the float value (e.g. "0.5") of the env variable, or def if it is not set.
+func GetEnvFloat(env string, def float64) float64 {
+	envStr := os.Getenv(env)
+	if envStr == "" {
+		return def
+	}
+
+	value, err := strconv.ParseFloat(envStr, 64)
+	if err != nil {
+		log.Fatalf("env variable is not a number: %s", env)
+	}
+
+	return value
+}
+
+// GetEnvDuration returns the duration value (e.g. "500ms") of the env variable, or def if it is not set.
+func GetEnvDuration(env string, def time.Duration) time.Duration {
+	envStr := os.Getenv(env)
+	if envStr == "" {
+		return def
+	}
+
+	value, err := time.ParseDuration(envStr)
+	if err != nil {
+		log.Fatalf("env variable is not a duration: %s", env)
+	}
+
+	return value
+}
+
+// GetEnvBool returns the boolean value (e.g. "true", "1") of the env variable, or def if it is not set.
+func GetEnvBool(env string, def bool) bool {
+	envStr := os.Getenv(env)
+	if envStr == "" {
+		return def
+	}
+
+	value, err := strconv.ParseBool(envStr)
+	if err != nil {
+		log.Fatalf("env variable is not a boolean: %s", env)
 	}
-	defer out.Close()
 
-	return jpeg.Encode(out, img, nil)
+	return value
 }